@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/romshark/seplistbench/generate-go/valist"
+)
+
+// analyze scans a generated corpus and reports how its realized
+// distributions compare to what the configuration requested
+func analyze(args []string) {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	configFilePath := flags.String(
+		"c",
+		"./generate-conf.toml",
+		"generator configuration TOML file path",
+	)
+	inputFilePath := flags.String(
+		"i",
+		"./out.txt",
+		"corpus file path",
+	)
+	zThreshold := flags.Float64(
+		"z",
+		3.89,
+		"z-score above which a deviation is considered significant",
+	)
+	_ = flags.Parse(args)
+
+	conf, warnings, err := valist.ConfigFromFileTOML(*configFilePath)
+	try("reading config file", err)
+	for _, w := range warnings {
+		log.Printf("config: %s", w)
+	}
+
+	inFile, err := os.Open(*inputFilePath)
+	try("opening corpus file", err)
+	defer inFile.Close()
+
+	stats, err := scanCorpus(conf, inFile)
+	try("scanning corpus", err)
+
+	report := stats.report(conf, *zThreshold)
+	for _, d := range report.Deviations {
+		log.Printf("deviation: %s", d)
+	}
+
+	jsonEnc := json.NewEncoder(os.Stdout)
+	jsonEnc.SetIndent("", "  ")
+	try("writing report", jsonEnc.Encode(report))
+}
+
+// corpusStats holds the realized statistics of a scanned corpus
+type corpusStats struct {
+	entries      uint64
+	labels       []uint64
+	delimiters   []uint64
+	separators   []uint64
+	entryLengths map[int]uint64
+	minVal       int32
+	maxVal       int32
+
+	// Running moments (Welford/Terriberry)
+	mean, m2, m3, m4 float64
+}
+
+func (s *corpusStats) addValue(v int32) {
+	if s.entries == 0 || v < s.minVal {
+		s.minVal = v
+	}
+	if s.entries == 0 || v > s.maxVal {
+		s.maxVal = v
+	}
+	n1 := float64(s.entries)
+	s.entries++
+	n := float64(s.entries)
+	delta := float64(v) - s.mean
+	deltaN := delta / n
+	deltaN2 := deltaN * deltaN
+	term1 := delta * deltaN * n1
+	s.mean += deltaN
+	s.m4 += term1*deltaN2*(n*n-3*n+3) + 6*deltaN2*s.m2 - 4*deltaN*s.m3
+	s.m3 += term1*deltaN*(n-2) - 3*deltaN*s.m2
+	s.m2 += term1
+}
+
+// scanCorpus parses the corpus according to the labels, delimiters
+// and separators defined by the configuration.
+// Tokens are matched greedily preferring the longest candidate
+func scanCorpus(conf *valist.Config, in io.Reader) (*corpusStats, error) {
+	s := &corpusStats{
+		labels:       make([]uint64, len(conf.Labels)),
+		delimiters:   make([]uint64, len(conf.Delimiters)),
+		separators:   make([]uint64, len(conf.Separators)),
+		entryLengths: make(map[int]uint64),
+	}
+
+	labels := newTokenSet(conf.Labels)
+	delimiters := newTokenSet(conf.Delimiters)
+	separators := newTokenSet(conf.Separators)
+
+	// Longest possible entry including the trailing separator
+	maxEntry := conf.MaxEntryLen()
+	bufSize := 64 * 1024
+	if bufSize < maxEntry {
+		bufSize = maxEntry
+	}
+	r := bufio.NewReaderSize(in, bufSize)
+
+	var offset int64
+	for {
+		b, err := r.Peek(maxEntry)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("reading: %w", err)
+		}
+		if len(b) < 1 {
+			if s.entries == 0 {
+				return nil, errors.New("empty corpus")
+			}
+			return nil, fmt.Errorf(
+				"unexpected end of input after separator at offset %d",
+				offset,
+			)
+		}
+
+		// Label
+		li, ln := labels.match(b)
+		if li < 0 {
+			return nil, fmt.Errorf("expected label at offset %d", offset)
+		}
+
+		// Delimiter
+		di, dn := delimiters.match(b[ln:])
+		if di < 0 {
+			return nil, fmt.Errorf(
+				"expected delimiter at offset %d",
+				offset+int64(ln),
+			)
+		}
+
+		// Value
+		vOff := ln + dn
+		val, vn, ok := parseInt32(b[vOff:])
+		if !ok {
+			return nil, fmt.Errorf(
+				"expected 32-bit integer value at offset %d",
+				offset+int64(vOff),
+			)
+		}
+
+		entryLen := vOff + vn
+		s.labels[li]++
+		s.delimiters[di]++
+		s.entryLengths[entryLen]++
+		s.addValue(val)
+
+		// Separator
+		if len(b) == entryLen {
+			// Last entry
+			return s, nil
+		}
+		si, sn := separators.match(b[entryLen:])
+		if si < 0 {
+			return nil, fmt.Errorf(
+				"expected separator at offset %d",
+				offset+int64(entryLen),
+			)
+		}
+		s.separators[si]++
+
+		if _, err := r.Discard(entryLen + sn); err != nil {
+			return nil, fmt.Errorf("reading: %w", err)
+		}
+		offset += int64(entryLen + sn)
+	}
+}
+
+// tokenSet matches the longest of a set of tokens at the beginning of input
+type tokenSet struct {
+	index   map[string]int
+	lengths []int // Distinct token lengths in descending order
+	maxLen  int
+}
+
+func newTokenSet(tokens []string) tokenSet {
+	s := tokenSet{index: make(map[string]int, len(tokens))}
+	lengths := make(map[int]struct{})
+	for i, t := range tokens {
+		s.index[t] = i
+		if _, ok := lengths[len(t)]; !ok {
+			lengths[len(t)] = struct{}{}
+			s.lengths = append(s.lengths, len(t))
+		}
+		if len(t) > s.maxLen {
+			s.maxLen = len(t)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(s.lengths)))
+	return s
+}
+
+// match returns the index and length of the matched token
+// or -1 if none of the tokens matches
+func (s tokenSet) match(b []byte) (index, length int) {
+	for _, l := range s.lengths {
+		if l > len(b) {
+			continue
+		}
+		if i, ok := s.index[string(b[:l])]; ok {
+			return i, l
+		}
+	}
+	return -1, 0
+}
+
+// parseInt32 parses a decimal signed 32-bit integer
+// at the beginning of b returning its length
+func parseInt32(b []byte) (v int32, length int, ok bool) {
+	negative := false
+	if len(b) > 0 && b[0] == '-' {
+		negative = true
+		length++
+	}
+	var x int64
+	start := length
+	for ; length < len(b) && b[length] >= '0' && b[length] <= '9'; length++ {
+		x = x*10 + int64(b[length]-'0')
+		if x > math.MaxInt32+1 {
+			return 0, 0, false
+		}
+	}
+	if length == start {
+		return 0, 0, false
+	}
+	if negative {
+		x = -x
+	}
+	if x > math.MaxInt32 || x < math.MinInt32 {
+		return 0, 0, false
+	}
+	return int32(x), length, true
+}
+
+// Report is the result of a corpus analysis
+type Report struct {
+	Entries      EntriesReport      `json:"entries"`
+	Labels       FrequencyReport    `json:"labels"`
+	Delimiters   FrequencyReport    `json:"delimiters"`
+	Separators   FrequencyReport    `json:"separators"`
+	Values       ValuesReport       `json:"values"`
+	EntryLengths EntryLengthsReport `json:"entry-lengths"`
+	Deviations   []string           `json:"deviations"`
+}
+
+// EntriesReport compares the number of entries to the configured range
+type EntriesReport struct {
+	Count uint64 `json:"count"`
+	Min   uint64 `json:"min"`
+	Max   uint64 `json:"max"`
+}
+
+// FrequencyReport compares the realized token frequencies
+// to a uniform distribution
+type FrequencyReport struct {
+	Tokens     []TokenFrequency `json:"tokens"`
+	ChiSquared float64          `json:"chi-squared"`
+	Z          float64          `json:"z"`
+}
+
+// TokenFrequency is the realized and expected frequency of a single token
+type TokenFrequency struct {
+	Token    string  `json:"token"`
+	Count    uint64  `json:"count"`
+	Expected float64 `json:"expected"`
+}
+
+// ValuesReport compares the realized value distribution moments
+// to those of a uniform distribution over the configured range
+type ValuesReport struct {
+	Min              int32   `json:"min"`
+	Max              int32   `json:"max"`
+	Mean             float64 `json:"mean"`
+	ExpectedMean     float64 `json:"expected-mean"`
+	MeanZ            float64 `json:"mean-z"`
+	Variance         float64 `json:"variance"`
+	ExpectedVariance float64 `json:"expected-variance"`
+	VarianceZ        float64 `json:"variance-z"`
+	Skewness         float64 `json:"skewness"`
+	ExcessKurtosis   float64 `json:"excess-kurtosis"`
+}
+
+// EntryLengthsReport compares the entry length histogram
+// to the lengths the configured labels, delimiters and values produce
+type EntryLengthsReport struct {
+	Lengths    []EntryLengthCount `json:"lengths"`
+	ChiSquared float64            `json:"chi-squared"`
+	Z          float64            `json:"z"`
+}
+
+// EntryLengthCount is a single entry length histogram bucket
+// where the length excludes the separator
+type EntryLengthCount struct {
+	Length   int     `json:"length"`
+	Count    uint64  `json:"count"`
+	Expected float64 `json:"expected"`
+}
+
+func (s *corpusStats) report(conf *valist.Config, zThreshold float64) Report {
+	r := Report{
+		Entries: EntriesReport{
+			Count: s.entries,
+			Min:   conf.MinValues,
+			Max:   conf.MaxValues,
+		},
+		Deviations: []string{},
+	}
+	deviation := func(format string, v ...interface{}) {
+		r.Deviations = append(r.Deviations, fmt.Sprintf(format, v...))
+	}
+
+	if s.entries < conf.MinValues || s.entries > conf.MaxValues {
+		deviation(
+			"%d entries outside of configured range [%d, %d]",
+			s.entries, conf.MinValues, conf.MaxValues,
+		)
+	}
+
+	// Token frequencies
+	r.Labels = frequencyReport(conf.Labels, s.labels)
+	r.Delimiters = frequencyReport(conf.Delimiters, s.delimiters)
+	r.Separators = frequencyReport(conf.Separators, s.separators)
+	for _, f := range []struct {
+		name string
+		FrequencyReport
+	}{
+		{"label", r.Labels},
+		{"delimiter", r.Delimiters},
+		{"separator", r.Separators},
+	} {
+		if f.Z > zThreshold {
+			deviation(
+				"%s frequencies not uniform (chi-squared: %.2f, z: %.2f)",
+				f.name, f.ChiSquared, f.Z,
+			)
+		}
+	}
+
+	// Value distribution moments
+	n := float64(s.entries)
+	r.Values = ValuesReport{
+		Min:      s.minVal,
+		Max:      s.maxVal,
+		Mean:     s.mean,
+		Variance: s.m2 / n,
+	}
+	if s.m2 > 0 {
+		r.Values.Skewness = math.Sqrt(n) * s.m3 / math.Pow(s.m2, 1.5)
+		r.Values.ExcessKurtosis = n*s.m4/(s.m2*s.m2) - 3
+	}
+	if s.minVal < conf.MinVal || s.maxVal > conf.MaxVal {
+		deviation(
+			"values [%d, %d] outside of configured range [%d, %d]",
+			s.minVal, s.maxVal, conf.MinVal, conf.MaxVal,
+		)
+	}
+
+	// Discrete uniform distribution over [min-val, max-val]
+	width := float64(conf.MaxVal) - float64(conf.MinVal) + 1
+	r.Values.ExpectedMean = (float64(conf.MinVal) + float64(conf.MaxVal)) / 2
+	r.Values.ExpectedVariance = (width*width - 1) / 12
+	if r.Values.ExpectedVariance > 0 {
+		sigma := math.Sqrt(r.Values.ExpectedVariance)
+		r.Values.MeanZ = (r.Values.Mean - r.Values.ExpectedMean) /
+			(sigma / math.Sqrt(n))
+
+		kurtosis := 3 - 6*(width*width+1)/(5*(width*width-1))
+		varianceSE := r.Values.ExpectedVariance *
+			math.Sqrt((kurtosis-1)/n)
+		r.Values.VarianceZ = (r.Values.Variance -
+			r.Values.ExpectedVariance) / varianceSE
+
+		if math.Abs(r.Values.MeanZ) > zThreshold {
+			deviation(
+				"value mean %.2f deviates from expected %.2f (z: %.2f)",
+				r.Values.Mean, r.Values.ExpectedMean, r.Values.MeanZ,
+			)
+		}
+		if math.Abs(r.Values.VarianceZ) > zThreshold {
+			deviation(
+				"value variance %.2f deviates from expected %.2f (z: %.2f)",
+				r.Values.Variance,
+				r.Values.ExpectedVariance,
+				r.Values.VarianceZ,
+			)
+		}
+	}
+
+	// Entry length histogram
+	r.EntryLengths = entryLengthsReport(
+		s.entryLengths,
+		expectedEntryLengths(conf),
+		s.entries,
+	)
+	for _, l := range r.EntryLengths.Lengths {
+		if l.Count > 0 && l.Expected == 0 {
+			deviation(
+				"%d entries of impossible length %d",
+				l.Count, l.Length,
+			)
+		}
+	}
+	if r.EntryLengths.Z > zThreshold {
+		deviation(
+			"entry lengths don't fit the configuration "+
+				"(chi-squared: %.2f, z: %.2f)",
+			r.EntryLengths.ChiSquared, r.EntryLengths.Z,
+		)
+	}
+
+	return r
+}
+
+// entryLengthsReport performs a chi-squared goodness-of-fit test
+// of the observed entry lengths against the expected length probabilities.
+// Lengths expected fewer than 5 times are pooled into a single bucket
+// to keep the chi-squared approximation valid.
+// Observed lengths of probability 0 are reported but not tested
+func entryLengthsReport(
+	observed map[int]uint64,
+	probabilities map[int]float64,
+	entries uint64,
+) EntryLengthsReport {
+	lengths := make([]int, 0, len(probabilities))
+	for l := range probabilities {
+		lengths = append(lengths, l)
+	}
+	for l := range observed {
+		if _, ok := probabilities[l]; !ok {
+			lengths = append(lengths, l)
+		}
+	}
+	sort.Ints(lengths)
+
+	r := EntryLengthsReport{Lengths: make([]EntryLengthCount, len(lengths))}
+	var pooledCount, pooledExpected float64
+	buckets := 0
+	for i, l := range lengths {
+		c := EntryLengthCount{
+			Length:   l,
+			Count:    observed[l],
+			Expected: probabilities[l] * float64(entries),
+		}
+		r.Lengths[i] = c
+		switch {
+		case c.Expected == 0:
+		case c.Expected < 5:
+			pooledCount += float64(c.Count)
+			pooledExpected += c.Expected
+		default:
+			d := float64(c.Count) - c.Expected
+			r.ChiSquared += d * d / c.Expected
+			buckets++
+		}
+	}
+	if pooledExpected > 0 {
+		d := pooledCount - pooledExpected
+		r.ChiSquared += d * d / pooledExpected
+		buckets++
+	}
+	r.Z = chiSquaredZ(r.ChiSquared, float64(buckets-1))
+	return r
+}
+
+// expectedEntryLengths returns the probabilities of the entry lengths
+// excluding the separator, which are the sums of a uniformly chosen label,
+// delimiter and uniformly distributed value
+func expectedEntryLengths(conf *valist.Config) map[int]float64 {
+	p := tokenLengths(conf.Labels)
+	for _, dist := range []map[int]float64{
+		tokenLengths(conf.Delimiters),
+		valueLengths(conf.MinVal, conf.MaxVal),
+	} {
+		sum := make(map[int]float64, len(p)*len(dist))
+		for l1, p1 := range p {
+			for l2, p2 := range dist {
+				sum[l1+l2] += p1 * p2
+			}
+		}
+		p = sum
+	}
+	return p
+}
+
+// tokenLengths returns the length probabilities
+// of a uniformly chosen token
+func tokenLengths(tokens []string) map[int]float64 {
+	p := make(map[int]float64)
+	for _, t := range tokens {
+		p[len(t)] += 1 / float64(len(tokens))
+	}
+	return p
+}
+
+// valueLengths returns the decimal length probabilities of a value
+// uniformly distributed over [min, max] including the minus sign
+func valueLengths(min, max int32) map[int]float64 {
+	p := make(map[int]float64)
+	width := float64(max) - float64(min) + 1
+
+	// count adds the magnitudes in [lo, hi] by their number of digits
+	count := func(lo, hi int64, sign int) {
+		for digits, pow := 1, int64(10); ; digits, pow = digits+1, pow*10 {
+			a, b := pow/10, pow-1
+			if digits == 1 {
+				a = 0
+			}
+			if a < lo {
+				a = lo
+			}
+			if b > hi {
+				b = hi
+			}
+			if a <= b {
+				p[sign+digits] += float64(b-a+1) / width
+			}
+			if pow > hi {
+				return
+			}
+		}
+	}
+	if max >= 0 {
+		lo := int64(min)
+		if lo < 0 {
+			lo = 0
+		}
+		count(lo, int64(max), 0)
+	}
+	if min < 0 {
+		hi := int64(max)
+		if hi > -1 {
+			hi = -1
+		}
+		// Magnitudes of the negative values prefixed by '-'
+		count(-hi, -int64(min), 1)
+	}
+	return p
+}
+
+// frequencyReport performs a chi-squared goodness-of-fit test
+// of the observed counts against a uniform distribution
+func frequencyReport(tokens []string, counts []uint64) FrequencyReport {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	r := FrequencyReport{Tokens: make([]TokenFrequency, len(tokens))}
+	expected := float64(total) / float64(len(tokens))
+	for i, t := range tokens {
+		r.Tokens[i] = TokenFrequency{
+			Token:    t,
+			Count:    counts[i],
+			Expected: expected,
+		}
+		d := float64(counts[i]) - expected
+		if expected > 0 {
+			r.ChiSquared += d * d / expected
+		}
+	}
+	if total > 0 {
+		r.Z = chiSquaredZ(r.ChiSquared, float64(len(tokens)-1))
+	}
+	return r
+}
+
+// chiSquaredZ converts a chi-squared statistic with df degrees of freedom
+// to an approximately standard normal z-score using
+// the Wilson-Hilferty transformation.
+// Returns 0 if df is smaller 1
+func chiSquaredZ(chiSquared, df float64) float64 {
+	if df < 1 {
+		return 0
+	}
+	v := 2 / (9 * df)
+	return (math.Cbrt(chiSquared/df) - (1 - v)) / math.Sqrt(v)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/romshark/seplistbench/generate-go/valist"
+)
+
+func analyzeConfig(t *testing.T, c valist.Config) *valist.Config {
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return &c
+}
+
+func TestScanCorpus(t *testing.T) {
+	conf := analyzeConfig(t, valist.Config{
+		MinValues:  1,
+		MaxValues:  10,
+		MinVal:     math.MinInt32,
+		MaxVal:     math.MaxInt32,
+		Labels:     []string{"A", "AB"},
+		Delimiters: []string{"=", "=="},
+		Separators: []string{";", ";;"},
+	})
+
+	for _, tt := range []struct {
+		name     string
+		corpus   string
+		expected *corpusStats
+		err      string
+	}{
+		{
+			name:   "greedy",
+			corpus: "AB==5;;A=-3;A==-2147483648",
+			expected: &corpusStats{
+				entries:      3,
+				labels:       []uint64{2, 1},
+				delimiters:   []uint64{1, 2},
+				separators:   []uint64{1, 1},
+				entryLengths: map[int]uint64{5: 1, 4: 1, 14: 1},
+				minVal:       math.MinInt32,
+				maxVal:       5,
+			},
+		},
+		{
+			name:   "single",
+			corpus: "A=2147483647",
+			expected: &corpusStats{
+				entries:      1,
+				labels:       []uint64{1, 0},
+				delimiters:   []uint64{1, 0},
+				separators:   []uint64{0, 0},
+				entryLengths: map[int]uint64{12: 1},
+				minVal:       math.MaxInt32,
+				maxVal:       math.MaxInt32,
+			},
+		},
+		{
+			name:   "trailing separator",
+			corpus: "A=1;AB=2;",
+			err:    "unexpected end of input after separator at offset 9",
+		},
+		{
+			name:   "empty",
+			corpus: "",
+			err:    "empty corpus",
+		},
+		{
+			name:   "overflow",
+			corpus: "A=1;A=2147483648",
+			err:    "expected 32-bit integer value at offset 6",
+		},
+		{
+			name:   "underflow",
+			corpus: "A=-2147483649",
+			err:    "expected 32-bit integer value at offset 2",
+		},
+		{
+			name:   "unknown label",
+			corpus: "A=1;B=2",
+			err:    "expected label at offset 4",
+		},
+		{
+			name:   "missing delimiter",
+			corpus: "AB:1",
+			err:    "expected delimiter at offset 2",
+		},
+		{
+			name:   "unknown separator",
+			corpus: "A=1,A=2",
+			err:    "expected separator at offset 3",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := scanCorpus(conf, strings.NewReader(tt.corpus))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Compare the counts only, the moments are covered by report
+			s.mean, s.m2, s.m3, s.m4 = 0, 0, 0, 0
+			if !reflect.DeepEqual(tt.expected, s) {
+				t.Errorf("expected %+v, got %+v", tt.expected, s)
+			}
+		})
+	}
+}
+
+func TestParseInt32(t *testing.T) {
+	for _, tt := range []struct {
+		input  string
+		value  int32
+		length int
+		ok     bool
+	}{
+		{"0", 0, 1, true},
+		{"-0", 0, 2, true},
+		{"42; A", 42, 2, true},
+		{"-17=", -17, 3, true},
+		{"2147483647", math.MaxInt32, 10, true},
+		{"-2147483648", math.MinInt32, 11, true},
+		{"2147483648", 0, 0, false},
+		{"-2147483649", 0, 0, false},
+		{"99999999999999999999", 0, 0, false},
+		{"-", 0, 0, false},
+		{"", 0, 0, false},
+		{"x1", 0, 0, false},
+	} {
+		v, length, ok := parseInt32([]byte(tt.input))
+		if v != tt.value || length != tt.length || ok != tt.ok {
+			t.Errorf(
+				"%q: expected (%d, %d, %t), got (%d, %d, %t)",
+				tt.input, tt.value, tt.length, tt.ok, v, length, ok,
+			)
+		}
+	}
+}
+
+func TestFrequencyReport(t *testing.T) {
+	tokens := []string{"A", "B", "C"}
+	for _, tt := range []struct {
+		name       string
+		counts     []uint64
+		expected   float64
+		chiSquared float64
+		uniform    bool
+	}{
+		{"uniform", []uint64{10, 10, 10}, 10, 0, true},
+		{"close", []uint64{11, 9, 10}, 10, 0.2, true},
+		{"skewed", []uint64{30, 0, 0}, 10, 60, false},
+		{"empty", []uint64{0, 0, 0}, 0, 0, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := frequencyReport(tokens, tt.counts)
+			for i, f := range r.Tokens {
+				if f.Token != tokens[i] || f.Count != tt.counts[i] ||
+					f.Expected != tt.expected {
+					t.Errorf("unexpected token frequency %d: %+v", i, f)
+				}
+			}
+			if math.Abs(r.ChiSquared-tt.chiSquared) > 1e-9 {
+				t.Errorf(
+					"expected chi-squared %f, got %f",
+					tt.chiSquared, r.ChiSquared,
+				)
+			}
+			if uniform := r.Z <= 3.89; uniform != tt.uniform {
+				t.Errorf("expected uniform: %t, got z: %f", tt.uniform, r.Z)
+			}
+		})
+	}
+}
+
+func TestValueLengths(t *testing.T) {
+	for _, tt := range []struct {
+		min, max int32
+		expected map[int]float64
+	}{
+		{0, 0, map[int]float64{1: 1}},
+		{0, 99, map[int]float64{1: 0.1, 2: 0.9}},
+		{-10, 9, map[int]float64{1: 0.5, 2: 0.45, 3: 0.05}},
+		{-5, -1, map[int]float64{2: 1}},
+		{5, 14, map[int]float64{1: 0.5, 2: 0.5}},
+	} {
+		p := valueLengths(tt.min, tt.max)
+		equal := len(p) == len(tt.expected)
+		for l, e := range tt.expected {
+			equal = equal && math.Abs(p[l]-e) < 1e-9
+		}
+		if !equal {
+			t.Errorf(
+				"[%d, %d]: expected %v, got %v",
+				tt.min, tt.max, tt.expected, p,
+			)
+		}
+	}
+
+	// The full range must be a proper distribution
+	var total float64
+	p := valueLengths(math.MinInt32, math.MaxInt32)
+	for _, x := range p {
+		total += x
+	}
+	if math.Abs(total-1) > 1e-9 || p[11] == 0 || p[10] == 0 {
+		t.Errorf("unexpected full range distribution: %v", p)
+	}
+}
+
+func TestExpectedEntryLengths(t *testing.T) {
+	conf := analyzeConfig(t, valist.Config{
+		MinValues:  1,
+		MaxValues:  1,
+		MinVal:     0,
+		MaxVal:     19,
+		Labels:     []string{"A", "BB"},
+		Delimiters: []string{"=", " = "},
+	})
+	// Label and delimiter lengths 2, 3, 4 and 5 plus value lengths 1 and 2
+	expected := map[int]float64{
+		3: 0.125, 4: 0.25, 5: 0.25, 6: 0.25, 7: 0.125,
+	}
+	p := expectedEntryLengths(conf)
+	if len(p) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, p)
+	}
+	for l, e := range expected {
+		if math.Abs(p[l]-e) > 1e-9 {
+			t.Fatalf("expected %v, got %v", expected, p)
+		}
+	}
+}
+
+// replaceFirstEntry replaces the first entry of a corpus
+// separated by ";" or " ; "
+func replaceFirstEntry(corpus, entry string) string {
+	first := strings.TrimRight(corpus[:strings.Index(corpus, ";")], " ")
+	return entry + corpus[len(first):]
+}
+
+func TestReport(t *testing.T) {
+	conf := analyzeConfig(t, valist.Config{
+		RandomSeed: 1,
+		MinValues:  10000,
+		MaxValues:  10000,
+		MinVal:     -1000,
+		MaxVal:     1000,
+		Labels:     []string{"A", "BB", "CCC"},
+		Delimiters: []string{"=", " = "},
+		Separators: []string{";", " ; "},
+	})
+	var generated bytes.Buffer
+	if _, _, err := valist.Generate(conf, &generated, valist.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		corpus     string
+		deviations []string
+	}{
+		{
+			name:   "generated",
+			corpus: generated.String(),
+		},
+		{
+			name:   "entries",
+			corpus: "A=1;BB=-1;CCC=0",
+			deviations: []string{
+				"3 entries outside of configured range [10000, 10000]",
+			},
+		},
+		{
+			name:   "skewed",
+			corpus: strings.Repeat("A=0;", 9999) + "A=0",
+			deviations: []string{
+				"label frequencies not uniform",
+				"delimiter frequencies not uniform",
+				"separator frequencies not uniform",
+				"value variance 0.00 deviates",
+				"entry lengths don't fit the configuration",
+			},
+		},
+		{
+			name:   "values",
+			corpus: replaceFirstEntry(generated.String(), "A=1001"),
+			deviations: []string{
+				"values [-1000, 1001] outside of configured range [-1000, 1000]",
+			},
+		},
+		{
+			// Zero-padded values are in range but too long
+			name:   "impossible length",
+			corpus: replaceFirstEntry(generated.String(), "A=00000000001"),
+			deviations: []string{
+				"1 entries of impossible length 13",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := scanCorpus(conf, strings.NewReader(tt.corpus))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := s.report(conf, 3.89)
+			if len(r.Deviations) != len(tt.deviations) {
+				t.Fatalf(
+					"expected %d deviations, got %d: %q",
+					len(tt.deviations), len(r.Deviations), r.Deviations,
+				)
+			}
+			for i, d := range tt.deviations {
+				if !strings.HasPrefix(r.Deviations[i], d) {
+					t.Errorf("expected deviation %q, got %q", d, r.Deviations[i])
+				}
+			}
+		})
+	}
+}
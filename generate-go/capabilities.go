@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/romshark/seplistbench/generate-go/valist"
+)
+
+// Capabilities describes what the installed generator supports
+// allowing other tools to feature-detect it
+type Capabilities struct {
+	FormatRevision    int       `json:"format-revision"`
+	ConfigVersion     int       `json:"config-version"`
+	Formats           []string  `json:"formats"`
+	ValueTypes        []string  `json:"value-types"`
+	Distributions     []string  `json:"distributions"`
+	CompressionCodecs []string  `json:"compression-codecs"`
+	Aggregates        []string  `json:"aggregates"`
+	SketchQuantiles   []float64 `json:"sketch-quantiles"`
+	Subcommands       []string  `json:"subcommands"`
+}
+
+// capabilities prints the generator capabilities as JSON
+func capabilities(args []string) {
+	flags := flag.NewFlagSet("capabilities", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	try("writing capabilities", writeCapabilities(os.Stdout))
+}
+
+// writeCapabilities writes the capabilities as indented JSON
+func writeCapabilities(w io.Writer) error {
+	subcommands := make([]string, 0, len(commands))
+	for name := range commands {
+		subcommands = append(subcommands, name)
+	}
+	sort.Strings(subcommands)
+
+	jsonEnc := json.NewEncoder(w)
+	jsonEnc.SetIndent("", "  ")
+	return jsonEnc.Encode(Capabilities{
+		FormatRevision:    valist.FormatRevision,
+		ConfigVersion:     valist.ConfigVersion,
+		Formats:           []string{"value-list"},
+		ValueTypes:        []string{"int32"},
+		Distributions:     []string{"uniform"},
+		CompressionCodecs: []string{},
+		Aggregates: []string{
+			"labels", "sketches", "top-k", "windows", "levels",
+		},
+		SketchQuantiles: valist.SketchQuantiles,
+		Subcommands:     subcommands,
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/romshark/seplistbench/generate-go/valist"
+)
+
+func TestCapabilities(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeCapabilities(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	var c Capabilities
+	dec := json.NewDecoder(&b)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.FormatRevision != valist.FormatRevision {
+		t.Errorf(
+			"expected format revision %d, got %d",
+			valist.FormatRevision, c.FormatRevision,
+		)
+	}
+	if c.ConfigVersion != valist.ConfigVersion {
+		t.Errorf(
+			"expected config version %d, got %d",
+			valist.ConfigVersion, c.ConfigVersion,
+		)
+	}
+	expected := []string{
+		"analyze", "capabilities", "fetch", "publish", "spec-vectors",
+	}
+	if !reflect.DeepEqual(expected, c.Subcommands) {
+		t.Errorf("expected subcommands %v, got %v", expected, c.Subcommands)
+	}
+	if !reflect.DeepEqual(valist.SketchQuantiles, c.SketchQuantiles) {
+		t.Errorf(
+			"expected sketch quantiles %v, got %v",
+			valist.SketchQuantiles, c.SketchQuantiles,
+		)
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/romshark/seplistbench/generate-go/valist"
+)
+
+// manifestFile is the name of the manifest of a published dataset.
+// A dataset is published at <url>/<name>/<version>/
+const manifestFile = "manifest.json"
+
+// partSuffix is the suffix of files being downloaded
+const partSuffix = ".part"
+
+// Manifest describes a published dataset
+type Manifest struct {
+	Name           string         `json:"name"`
+	Version        string         `json:"version"`
+	FormatRevision int            `json:"format-revision"`
+	Files          []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a single file of a published dataset
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// dataset identifies a dataset in a store and its local directory
+type dataset struct {
+	url, name, version, dir string
+}
+
+// datasetFromFlags parses the dataset flags of the named subcommand.
+// The local directory is required if defaultDir is empty
+func datasetFromFlags(name, defaultDir string, args []string) dataset {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	storeURL := flags.String(
+		"url",
+		os.Getenv("VALISTBENCH_DATASET_URL"),
+		"dataset store base URL (defaults to $VALISTBENCH_DATASET_URL)",
+	)
+	datasetName := flags.String("name", "", "dataset name")
+	version := flags.String("version", "", "dataset version")
+	dirUsage := "local dataset directory"
+	if defaultDir == "" {
+		dirUsage += " (required)"
+	}
+	dir := flags.String("dir", defaultDir, dirUsage)
+	_ = flags.Parse(args)
+	return dataset{
+		url:     *storeURL,
+		name:    *datasetName,
+		version: *version,
+		dir:     *dir,
+	}
+}
+
+// fileURL returns the URL of a file of the dataset
+func (d dataset) fileURL(file string) (string, error) {
+	switch {
+	case d.url == "":
+		return "", errors.New("missing dataset store URL")
+	case !validPathSegment(d.name):
+		return "", fmt.Errorf("invalid dataset name (%q)", d.name)
+	case !validPathSegment(d.version):
+		return "", fmt.Errorf("invalid dataset version (%q)", d.version)
+	}
+	u, err := url.Parse(d.url)
+	if err != nil {
+		return "", fmt.Errorf("parsing dataset store URL: %w", err)
+	}
+	u.Path = path.Join(u.Path, d.name, d.version, file)
+	return u.String(), nil
+}
+
+func validPathSegment(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\`)
+}
+
+// fetch downloads a published dataset verifying it against its manifest
+func fetch(args []string) {
+	try("fetching", fetchDataset(datasetFromFlags("fetch", ".", args)))
+}
+
+// publish uploads all files of a local dataset directory
+// followed by their manifest.
+// Partial downloads (*.part) are skipped
+func publish(args []string) {
+	try("publishing", publishDataset(datasetFromFlags("publish", "", args)))
+}
+
+func fetchDataset(d dataset) error {
+	manifestURL, err := d.fileURL(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	var m Manifest
+	if err := httpGetJSON(manifestURL, &m); err != nil {
+		return fmt.Errorf("fetching manifest: %w", err)
+	}
+	if m.Name != d.name || m.Version != d.version {
+		return fmt.Errorf(
+			"manifest describes %s/%s instead of %s/%s",
+			m.Name, m.Version, d.name, d.version,
+		)
+	}
+	if m.FormatRevision != valist.FormatRevision {
+		log.Printf(
+			"warning: dataset has format revision %d, generator has %d",
+			m.FormatRevision, valist.FormatRevision,
+		)
+	}
+
+	if err := os.MkdirAll(d.dir, 0777); err != nil {
+		return fmt.Errorf("creating dataset directory: %w", err)
+	}
+	for _, f := range m.Files {
+		if !validPathSegment(f.Path) || f.Path == manifestFile {
+			return fmt.Errorf("invalid file path in manifest: %q", f.Path)
+		}
+		localPath := filepath.Join(d.dir, f.Path)
+		if ok, _ := verifyFile(localPath, f); ok {
+			log.Printf("%s is up to date", localPath)
+			continue
+		}
+
+		fileURL, err := d.fileURL(f.Path)
+		if err != nil {
+			return err
+		}
+		if err := download(fileURL, localPath, f); err != nil {
+			return fmt.Errorf("fetching %s: %w", f.Path, err)
+		}
+		log.Printf("%s fetched (%d bytes)", localPath, f.Size)
+	}
+
+	if err := writeJSONFile(filepath.Join(d.dir, manifestFile), m); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
+
+func publishDataset(d dataset) error {
+	if d.dir == "" {
+		return errors.New("missing dataset directory")
+	}
+	manifestURL, err := d.fileURL(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return fmt.Errorf("reading dataset directory: %w", err)
+	}
+
+	m := Manifest{
+		Name:           d.name,
+		Version:        d.version,
+		FormatRevision: valist.FormatRevision,
+	}
+	for _, e := range entries {
+		if !e.Mode().IsRegular() ||
+			e.Name() == manifestFile ||
+			strings.HasSuffix(e.Name(), partSuffix) {
+			continue
+		}
+		f, err := hashFile(filepath.Join(d.dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("hashing %s: %w", e.Name(), err)
+		}
+		m.Files = append(m.Files, f)
+	}
+	if len(m.Files) < 1 {
+		return fmt.Errorf("no files to publish in %s", d.dir)
+	}
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+
+	// Upload the manifest last to never expose an incomplete dataset
+	for _, f := range m.Files {
+		fileURL, err := d.fileURL(f.Path)
+		if err != nil {
+			return err
+		}
+		err = uploadFile(fileURL, filepath.Join(d.dir, f.Path), f.Size)
+		if err != nil {
+			return fmt.Errorf("uploading %s: %w", f.Path, err)
+		}
+		log.Printf("%s uploaded (%d bytes)", f.Path, f.Size)
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	err = httpPut(manifestURL, bytes.NewReader(manifest), int64(len(manifest)))
+	if err != nil {
+		return fmt.Errorf("uploading manifest: %w", err)
+	}
+	log.Printf("%s/%s published to %s", m.Name, m.Version, d.url)
+	return nil
+}
+
+func uploadFile(fileURL, p string, size int64) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return httpPut(fileURL, f, size)
+}
+
+// hashFile computes the manifest entry of a local file
+func hashFile(p string) (ManifestFile, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	return ManifestFile{
+		Path:   filepath.Base(p),
+		Size:   n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// verifyFile checks whether the local file matches its manifest entry
+func verifyFile(p string, expected ManifestFile) (bool, error) {
+	actual, err := hashFile(p)
+	if err != nil {
+		return false, err
+	}
+	return actual.Size == expected.Size && actual.SHA256 == expected.SHA256, nil
+}
+
+// download downloads a file to a temporary file next to p
+// and renames it to p once it's verified
+func download(fileURL, p string, expected ManifestFile) error {
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	tmp := p + partSuffix
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0777)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	h := sha256.New()
+	// Read one byte more than expected to detect oversized files
+	n, err := io.Copy(
+		io.MultiWriter(f, h),
+		io.LimitReader(resp.Body, expected.Size+1),
+	)
+	if err != nil {
+		return fmt.Errorf("downloading: %w", err)
+	}
+	if n != expected.Size {
+		return fmt.Errorf("size mismatch: expected %d, got %d", expected.Size, n)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != expected.SHA256 {
+		return fmt.Errorf(
+			"checksum mismatch: expected %s, got %s",
+			expected.SHA256, sum,
+		)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("syncing file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing file: %w", err)
+	}
+	return os.Rename(tmp, p)
+}
+
+func httpGetJSON(u string, v interface{}) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// httpPut uploads body authorized by $VALISTBENCH_DATASET_TOKEN if set
+func httpPut(u string, body io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, u, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if token := os.Getenv("VALISTBENCH_DATASET_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
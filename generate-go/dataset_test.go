@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryStore is an in-memory dataset store
+type memoryStore struct {
+	lock  sync.Mutex
+	files map[string][]byte
+}
+
+func (s *memoryStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.files[r.URL.Path] = b
+	case http.MethodGet:
+		b, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(b)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPublishFetch(t *testing.T) {
+	store := &memoryStore{files: make(map[string][]byte)}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+
+	tmp, err := ioutil.TempDir("", "valistbench-dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	if err := os.Mkdir(src, 0777); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"out.txt":        "A = 56; A = -3; C = 2",
+		"aggregate.json": `{"A":{"values":2,"value":53}}`,
+	}
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(src, name), []byte(contents), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Partial downloads must not be published
+	err = ioutil.WriteFile(filepath.Join(src, "out.txt.part"), []byte("A ="), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := dataset{url: srv.URL + "/corpora", name: "tiny", version: "1"}
+	if err := publishDataset(d); err == nil {
+		t.Fatal("expected publishing without a directory to fail")
+	}
+
+	d.dir = src
+	if err := publishDataset(d); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.files["/corpora/tiny/1/manifest.json"]; !ok {
+		t.Fatal("manifest not published")
+	}
+	if _, ok := store.files["/corpora/tiny/1/out.txt.part"]; ok {
+		t.Error("partial download published")
+	}
+
+	d.dir = filepath.Join(tmp, "dst")
+	if err := fetchDataset(d); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		b, err := ioutil.ReadFile(filepath.Join(d.dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != contents {
+			t.Errorf("%s: expected %q, got %q", name, contents, string(b))
+		}
+	}
+
+	// Tampered files must be rejected
+	store.files["/corpora/tiny/1/out.txt"] = []byte("A = 57; A = -3; C = 2")
+	d.dir = filepath.Join(tmp, "tampered")
+	err = fetchDataset(d)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "out.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected tampered file to be removed, got %v", err)
+	}
+}
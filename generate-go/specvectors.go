@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/romshark/seplistbench/generate-go/valist"
+)
+
+// specVectorConfigs are the configurations the spec test vectors
+// are generated from, each covering a different part of the option surface.
+// Aggregate values are int32 and wrap around once a per-label sum
+// leaves the int32 range, so the vectors keep their sums within range
+var specVectorConfigs = []struct{ name, config string }{
+	{"single-entry", `
+config-version = 1
+random-seed = 1
+min-values = 1
+max-values = 1
+min-val = 0
+max-val = 10
+labels = ["A"]
+delimiters = ["="]
+separators = [";"]
+`},
+	{"default-tokens", `
+config-version = 1
+random-seed = 42
+min-values = 100
+max-values = 100
+min-val = 0
+max-val = 1000
+labels = ["ATB", "YYH", "JKL", "XLP"]
+`},
+	{"mixed-tokens", `
+config-version = 1
+random-seed = 7
+min-values = 500
+max-values = 500
+min-val = -1000
+max-val = 1000
+labels = ["Longbranch", "Pushmeat", "Oi", "MrSquids"]
+delimiters = ["=", " = ", "  =  ", " =", "= "]
+separators = [";", " ; ", "  ;  ", " ;", "; "]
+`},
+	{"entry-range", `
+config-version = 1
+random-seed = 3
+min-values = 10
+max-values = 1000
+min-val = 0
+max-val = 100
+labels = ["A", "B", "C"]
+`},
+	{"hierarchical", `
+config-version = 1
+random-seed = 11
+min-values = 300
+max-values = 300
+min-val = 0
+max-val = 1000
+label-components = [["api", "db"], ["eu", "us"], ["latency", "errors"]]
+delimiters = ["="]
+separators = [";"]
+`},
+}
+
+// specVectorPrefixLen is the default number of leading output bytes
+// included in each vector
+const specVectorPrefixLen = 256
+
+// SpecVectors is a set of test vectors allowing ports of the generator
+// to other languages to prove byte-exact compatibility.
+// The generator uses Go's math/rand source seeded with random-seed,
+// which ports must reproduce exactly
+type SpecVectors struct {
+	FormatRevision int          `json:"format-revision"`
+	ConfigVersion  int          `json:"config-version"`
+	Vectors        []SpecVector `json:"vectors"`
+}
+
+// SpecVector is a single test vector
+type SpecVector struct {
+	Name string `json:"name"`
+
+	// Config is the TOML configuration
+	Config string `json:"config"`
+	Seed   int64  `json:"seed"`
+
+	// ExpectedPrefix is the first bytes of the output
+	ExpectedPrefix string `json:"expected-prefix"`
+
+	// ExpectedLength and ExpectedSHA256 verify the full output
+	ExpectedLength int    `json:"expected-length"`
+	ExpectedSHA256 string `json:"expected-sha256"`
+
+	ExpectedAggregate map[string]valist.Aggregate `json:"expected-aggregate"`
+}
+
+// specVectors prints the spec test vectors as JSON
+func specVectors(args []string) {
+	flags := flag.NewFlagSet("spec-vectors", flag.ExitOnError)
+	prefixLen := flags.Int(
+		"n",
+		specVectorPrefixLen,
+		"number of leading output bytes included in each vector",
+	)
+	_ = flags.Parse(args)
+	if *prefixLen < 0 {
+		log.Fatalf("invalid prefix length (%d)", *prefixLen)
+	}
+
+	v, err := buildSpecVectors(*prefixLen)
+	try("generating spec vectors", err)
+
+	jsonEnc := json.NewEncoder(os.Stdout)
+	jsonEnc.SetIndent("", "  ")
+	try("writing spec vectors", jsonEnc.Encode(v))
+}
+
+// buildSpecVectors generates the spec test vectors
+// including the first prefixLen bytes of each output
+func buildSpecVectors(prefixLen int) (SpecVectors, error) {
+	v := SpecVectors{
+		FormatRevision: valist.FormatRevision,
+		ConfigVersion:  valist.ConfigVersion,
+		Vectors:        make([]SpecVector, len(specVectorConfigs)),
+	}
+	for i, c := range specVectorConfigs {
+		vec, err := specVector(c.name, c.config, prefixLen)
+		if err != nil {
+			return SpecVectors{}, fmt.Errorf("vector %q: %w", c.name, err)
+		}
+		v.Vectors[i] = vec
+	}
+	return v, nil
+}
+
+func specVector(name, config string, prefixLen int) (SpecVector, error) {
+	conf, _, err := valist.ConfigFromTOML(config)
+	if err != nil {
+		return SpecVector{}, fmt.Errorf("parsing config: %w", err)
+	}
+
+	var out bytes.Buffer
+	aggregate, written, err := valist.Generate(conf, &out, valist.Options{})
+	if err != nil {
+		return SpecVector{}, err
+	}
+
+	if prefixLen > written {
+		prefixLen = written
+	}
+	hash := sha256.Sum256(out.Bytes())
+	return SpecVector{
+		Name:              name,
+		Config:            config,
+		Seed:              conf.RandomSeed,
+		ExpectedPrefix:    string(out.Bytes()[:prefixLen]),
+		ExpectedLength:    written,
+		ExpectedSHA256:    hex.EncodeToString(hash[:]),
+		ExpectedAggregate: aggregate,
+	}, nil
+}
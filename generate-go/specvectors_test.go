@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/romshark/seplistbench/generate-go/valist"
+)
+
+var flagUpdate = flag.Bool("update", false, "update the golden spec vectors")
+
+// TestSpecVectors verifies the spec vectors against the golden file.
+// Any change of the generated bytes must increment valist.FormatRevision
+func TestSpecVectors(t *testing.T) {
+	goldenPath := filepath.Join("testdata", "spec-vectors.json")
+
+	v, err := buildSpecVectors(specVectorPrefixLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	jsonEnc := json.NewEncoder(&b)
+	jsonEnc.SetIndent("", "  ")
+	if err := jsonEnc.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+
+	if *flagUpdate {
+		if err := ioutil.WriteFile(goldenPath, b.Bytes(), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(golden, b.Bytes()) {
+		return
+	}
+
+	var expected SpecVectors
+	if err := json.Unmarshal(golden, &expected); err != nil {
+		t.Fatalf("decoding %s: %s", goldenPath, err)
+	}
+	for i, vec := range v.Vectors {
+		if i >= len(expected.Vectors) ||
+			vec.ExpectedSHA256 != expected.Vectors[i].ExpectedSHA256 {
+			t.Errorf("vector %q: output changed", vec.Name)
+		}
+	}
+	if expected.FormatRevision == valist.FormatRevision {
+		t.Fatalf(
+			"spec vectors changed without a format revision bump, "+
+				"increment valist.FormatRevision (%d) and run "+
+				"go test -run TestSpecVectors -update",
+			valist.FormatRevision,
+		)
+	}
+	t.Fatalf(
+		"spec vectors outdated, run go test -run TestSpecVectors -update",
+	)
+}
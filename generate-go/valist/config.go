@@ -0,0 +1,223 @@
+package valist
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ConfigFromFileTOML reads the config from a TOML file
+// migrating it to ConfigVersion if it's older.
+// Returns a warning for every applied migration step
+func ConfigFromFileTOML(path string) (*Config, []string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading file: %w", err)
+	}
+	c, warnings, err := decodeConfig(string(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing file: %w", err)
+	}
+	if err := c.Prepare(); err != nil {
+		return nil, nil, err
+	}
+	return c, warnings, nil
+}
+
+// ConfigFromTOML parses the config from TOML
+// migrating it to ConfigVersion if it's older.
+// Returns a warning for every applied migration step
+func ConfigFromTOML(data string) (*Config, []string, error) {
+	c, warnings, err := decodeConfig(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.Prepare(); err != nil {
+		return nil, nil, err
+	}
+	return c, warnings, nil
+}
+
+// decodeConfig decodes the TOML config migrating it to ConfigVersion.
+// Configurations without the config-version key are considered version 1
+func decodeConfig(data string) (*Config, []string, error) {
+	c := &Config{}
+	meta, err := toml.Decode(data, c)
+	if err != nil {
+		// Name a mistyped config-version instead of the generic type error
+		raw := make(map[string]interface{})
+		if _, rawErr := toml.Decode(data, &raw); rawErr == nil {
+			if _, vErr := rawConfigVersion(raw); vErr != nil {
+				return nil, nil, vErr
+			}
+		}
+		return nil, nil, err
+	}
+	if !meta.IsDefined("config-version") {
+		// Version 1 predates the config-version key
+		c.Version = 1
+	}
+	if err := checkConfigVersion(int64(c.Version), ConfigVersion); err != nil {
+		return nil, nil, err
+	}
+	if c.Version == ConfigVersion {
+		return c, nil, nil
+	}
+	return migrateTOML(data)
+}
+
+// Config defines the generator configuration
+type Config struct {
+	// Version is the schema version, see ConfigVersion
+	Version    int      `toml:"config-version"`
+	TimeSeed   bool     `toml:"time-seed"`
+	RandomSeed int64    `toml:"random-seed"`
+	Labels     []string `toml:"labels"`
+	MinValues  uint64   `toml:"min-values"`
+	MaxValues  uint64   `toml:"max-values"`
+	MinVal     int32    `toml:"min-val"`
+	MaxVal     int32    `toml:"max-val"`
+	Delimiters []string `toml:"delimiters"`
+	Separators []string `toml:"separators"`
+
+	// LabelComponents generates hierarchical labels as the cartesian product
+	// of the component sets of each level, such as service.region.metric,
+	// instead of using Labels
+	LabelComponents [][]string `toml:"label-components"`
+
+	// LabelComponentSeparator joins the label components, defaults to "."
+	LabelComponentSeparator string `toml:"label-component-separator"`
+
+	// labelsGenerated is set once Labels were generated
+	// from LabelComponents allowing Prepare to be called repeatedly
+	labelsGenerated bool
+}
+
+// Prepare verifies and prepares the configuration for use
+func (c *Config) Prepare() error {
+	if len(c.LabelComponents) > 0 && !c.labelsGenerated {
+		if err := c.generateLabels(); err != nil {
+			return err
+		}
+		c.labelsGenerated = true
+	}
+
+	// Verify
+	switch {
+	case c.MinValues < 1:
+		return fmt.Errorf(
+			"max-values (%d) too small",
+			c.MinValues,
+		)
+	case c.MaxValues < c.MinValues:
+		return fmt.Errorf(
+			"max-values (%d) smaller min-values (%d)",
+			c.MinValues,
+			c.MaxValues,
+		)
+	case c.MaxVal < c.MinVal:
+		return fmt.Errorf(
+			"max-val (%d) smaller min-val (%d)",
+			c.MaxVal,
+			c.MinVal,
+		)
+	case len(c.Labels) < 1:
+		return errors.New("missing labels")
+	}
+
+	// Prepare
+	if len(c.Delimiters) < 1 {
+		c.Delimiters = []string{" = "}
+	}
+	if len(c.Separators) < 1 {
+		c.Separators = []string{"; "}
+	}
+
+	// Validate delimiters
+	delimiters := make(map[string]struct{}, len(c.Delimiters))
+	for i, d := range c.Delimiters {
+		if d == "" {
+			return fmt.Errorf("invalid delimiter (empty) at index %d", i)
+		}
+		if _, ok := delimiters[d]; ok {
+			// Duplicate
+			return fmt.Errorf("duplicate delimiter (%q) at index %d", d, i)
+		}
+		delimiters[d] = struct{}{}
+	}
+
+	// Validate labels
+	labels := make(map[string]struct{}, len(c.Labels))
+	labelsLen := 0
+	for i, l := range c.Labels {
+		if l == "" {
+			return fmt.Errorf("invalid label (empty) at index %d", i)
+		}
+		if _, ok := labels[l]; ok {
+			// Duplicate
+			return fmt.Errorf("duplicate label (%q) at index %d", l, i)
+		}
+		for _, c := range l {
+			// Labels must not contain space characters
+			if unicode.IsSpace(c) {
+				return fmt.Errorf("label at index %d contains spaces", i)
+			}
+		}
+		labels[l] = struct{}{}
+		labelsLen += len(l)
+	}
+	c.internLabels(labelsLen)
+
+	// Validate separators
+	separators := make(map[string]struct{}, len(c.Separators))
+	for i, s := range c.Separators {
+		if s == "" {
+			return fmt.Errorf("invalid separator (empty) at index %d", i)
+		}
+		if _, ok := separators[s]; ok {
+			// Duplicate
+			return fmt.Errorf("duplicate separator (%q) at index %d", s, i)
+		}
+		separators[s] = struct{}{}
+	}
+
+	return nil
+}
+
+// MaxEntryLen returns the maximum length of a single entry
+// including its trailing separator
+func (c *Config) MaxEntryLen() int {
+	return maxLen(c.Labels) +
+		maxLen(c.Delimiters) +
+		maxValueLen +
+		maxLen(c.Separators)
+}
+
+// internLabels copies all labels into a single string of the given length
+// and replaces them with substrings of it.
+// The interned labels are reused as aggregate keys,
+// which avoids keeping a separate allocation per label alive
+func (c *Config) internLabels(length int) {
+	var b strings.Builder
+	b.Grow(length)
+	for _, l := range c.Labels {
+		b.WriteString(l)
+	}
+	s := b.String()
+	for i, l := range c.Labels {
+		c.Labels[i], s = s[:len(l)], s[len(l):]
+	}
+}
+
+func maxLen(tokens []string) (max int) {
+	for _, t := range tokens {
+		if len(t) > max {
+			max = len(t)
+		}
+	}
+	return
+}
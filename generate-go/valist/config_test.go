@@ -0,0 +1,40 @@
+package valist
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfigFromFileTOMLErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		contents string
+		prefix   string
+		err      string
+	}{
+		{"syntax", "labels = [", "parsing file: ", ""},
+		{"type", "labels = 1", "parsing file: ", ""},
+		{"prepare", "min-values = 1\nmax-values = 1", "", "missing labels"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := configFile(t, tt.contents)
+			defer os.Remove(path)
+
+			_, _, err := ConfigFromFileTOML(path)
+			switch {
+			case err == nil:
+				t.Fatal("expected error")
+			case tt.prefix != "" && !strings.HasPrefix(err.Error(), tt.prefix):
+				t.Errorf("expected prefix %q, got %q", tt.prefix, err)
+			case tt.err != "" && err.Error() != tt.err:
+				t.Errorf("expected %q, got %q", tt.err, err)
+			}
+		})
+	}
+
+	_, _, err := ConfigFromFileTOML("nonexistent.toml")
+	if err == nil || !strings.HasPrefix(err.Error(), "reading file: ") {
+		t.Errorf("expected reading error, got %v", err)
+	}
+}
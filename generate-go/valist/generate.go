@@ -0,0 +1,248 @@
+package valist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// FormatRevision is the revision of the generated output.
+// It's incremented whenever the bytes generated for a given configuration
+// and seed change
+const FormatRevision = 1
+
+// Options defines generator options which don't affect the generated list
+type Options struct {
+	// SlabSize is the size in bytes of the slabs entries are batched into
+	// before being written. 0 writes every entry individually
+	SlabSize int
+
+	// ValueCacheSize is the capacity of the formatted value LRU cache.
+	// 0 disables caching
+	ValueCacheSize int
+
+	// OnEntry is invoked for every generated entry in the order
+	// the entries are written and allows computing custom aggregations
+	// in the same pass.
+	// It's called on the generation hot path and therefore
+	// directly affects generation throughput.
+	// label is only valid until OnEntry returns and must not be modified
+	OnEntry func(label []byte, value int64)
+
+	// Sketches enables approximate aggregates computed by
+	// HyperLogLog and t-digest sketches, see Aggregate.Sketch.
+	// Every label with values takes about 12 KiB of sketch memory
+	Sketches bool
+
+	// WindowSize enables tumbling-window aggregates of WindowSize
+	// consecutive entries each if greater 0.
+	// OnWindow is invoked for every window once its last entry
+	// is written and must be set if WindowSize is greater 0.
+	// The last window may contain fewer entries
+	WindowSize uint64
+	OnWindow   func(Window) error
+}
+
+// Generate writes a random separated value list to the given output writer.
+// Returns an error before writing anything if opts are invalid
+func Generate(conf *Config, out io.Writer, opts Options) (
+	aggregate map[string]Aggregate,
+	writtenBytes int,
+	err error,
+) {
+	if opts.WindowSize > 0 && opts.OnWindow == nil {
+		err = errors.New("window size set without OnWindow")
+		return
+	}
+	g := newGenerator(conf, out, opts)
+	for g.written < g.entries {
+		if err = g.writeEntry(); err != nil {
+			return
+		}
+	}
+
+	if err = g.w.flush(); err != nil {
+		err = fmt.Errorf("writing slab: %w", err)
+		return
+	}
+	writtenBytes = g.w.written
+	aggregate = g.aggregate()
+	return
+}
+
+// generator writes the entries of a random separated value list
+// one at a time.
+// The per-entry path must not allocate, see TestWriteEntryAllocs
+type generator struct {
+	conf  *Config
+	rand  *rand.Rand
+	w     *slabWriter
+	cache *valueCache
+
+	onEntry  func(label []byte, value int64)
+	sketches []labelSketch
+	window   *windowAggregator
+
+	// entries is the total number of entries to write
+	entries uint64
+	// written is the number of entries written so far
+	written uint64
+
+	sums     []int64
+	counters []uint64
+}
+
+func newGenerator(conf *Config, out io.Writer, opts Options) *generator {
+	seed := conf.RandomSeed
+	if conf.TimeSeed {
+		seed = time.Now().Unix()
+	}
+	g := &generator{
+		conf:     conf,
+		rand:     rand.New(rand.NewSource(seed)),
+		w:        newSlabWriter(out, opts.SlabSize, conf.MaxEntryLen()),
+		cache:    newValueCache(opts.ValueCacheSize),
+		onEntry:  opts.OnEntry,
+		sums:     make([]int64, len(conf.Labels)),
+		counters: make([]uint64, len(conf.Labels)),
+	}
+	if opts.Sketches {
+		g.sketches = make([]labelSketch, len(conf.Labels))
+	}
+	if opts.WindowSize > 0 {
+		g.window = newWindowAggregator(
+			conf.Labels,
+			opts.WindowSize,
+			opts.OnWindow,
+		)
+	}
+	g.entries = random(g.rand, conf.MinValues, conf.MaxValues)
+	return g
+}
+
+// writeEntry generates the next entry and appends it to the slab
+func (g *generator) writeEntry() error {
+	conf := g.conf
+	delim := conf.Delimiters[randomInt(g.rand, 0, len(conf.Delimiters)-1)]
+	labelIndex := randomInt(g.rand, 0, len(conf.Labels)-1)
+	label := conf.Labels[labelIndex]
+	separator := conf.Separators[randomInt(g.rand, 0, len(conf.Separators)-1)]
+
+	val := randomInt32(g.rand, conf.MinVal, conf.MaxVal)
+	if g.sums[labelIndex]+int64(val) > math.MaxInt32 {
+		// Negate the integer to avoid overflowing the aggregate
+		val = negateI32(val)
+	}
+
+	// Update aggregate
+	g.sums[labelIndex] += int64(val)
+	g.counters[labelIndex]++
+	g.written++
+	if g.sketches != nil {
+		g.sketches[labelIndex].add(val)
+	}
+
+	// Append entry
+	w := g.w
+	labelOffset := len(w.buf)
+	w.buf = append(w.buf, label...)
+	w.buf = append(w.buf, delim...)
+	if g.cache != nil {
+		w.buf = g.cache.appendValue(w.buf, val)
+	} else {
+		w.buf = strconv.AppendInt(w.buf, int64(val), 10)
+	}
+	if g.written < g.entries {
+		w.buf = append(w.buf, separator...)
+	}
+
+	if g.onEntry != nil {
+		g.onEntry(w.buf[labelOffset:labelOffset+len(label)], int64(val))
+	}
+
+	if err := w.commit(); err != nil {
+		return fmt.Errorf("writing slab: %w", err)
+	}
+
+	if g.window != nil {
+		err := g.window.add(
+			g.written-1,
+			g.written == g.entries,
+			labelIndex,
+			val,
+		)
+		if err != nil {
+			return fmt.Errorf("emitting window: %w", err)
+		}
+	}
+	return nil
+}
+
+// aggregate returns the aggregate of all entries written so far
+func (g *generator) aggregate() map[string]Aggregate {
+	aggregate := make(map[string]Aggregate, len(g.sums))
+	for index, value := range g.sums {
+		a := Aggregate{
+			Values: g.counters[index],
+			Value:  int32(value),
+			Sum:    value,
+		}
+		if g.sketches != nil {
+			a.Sketch = g.sketches[index].sketch()
+		}
+		aggregate[g.conf.Labels[index]] = a
+	}
+	return aggregate
+}
+
+// Aggregate represents the aggregate for a particular label
+type Aggregate struct {
+	Values uint64 `json:"values"`
+	Value  int32  `json:"value"`
+
+	// Sum is the exact sum of the values which Value is truncated from.
+	// It isn't part of the aggregate file to keep its format stable
+	Sum int64 `json:"-"`
+
+	// Sketch is only set when Options.Sketches is enabled
+	Sketch *Sketch `json:"sketch,omitempty"`
+}
+
+func random(r *rand.Rand, min, max uint64) uint64 {
+	if min == max {
+		return min
+	}
+	const maxInt64 uint64 = 1<<63 - 1
+	n := max - min
+	if n < maxInt64 {
+		return uint64(r.Int63n(int64(n+1))) + min
+	}
+	x := r.Uint64()
+	for x > n {
+		x = r.Uint64()
+	}
+	return x + min
+}
+
+func randomInt(r *rand.Rand, min, max int) int {
+	return r.Intn(max-min+1) + min
+}
+
+func randomInt32(r *rand.Rand, min, max int32) int32 {
+	if n := int64(max) - int64(min) + 1; n > math.MaxInt32 {
+		// The range exceeds what Int31n supports
+		return int32(r.Int63n(n) + int64(min))
+	}
+	return r.Int31n(max-min+1) + min
+}
+
+func negateI32(i int32) int32 {
+	if i < 1 {
+		return i - i*2
+	}
+	return i
+}
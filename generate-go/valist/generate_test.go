@@ -0,0 +1,360 @@
+package valist
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func benchConfig(b *testing.B, values uint64, minVal, maxVal int32) *Config {
+	c := &Config{
+		RandomSeed: 1,
+		MinValues:  values,
+		MaxValues:  values,
+		MinVal:     minVal,
+		MaxVal:     maxVal,
+		Labels: []string{
+			"Longbranch", "Pushmeat", "Chesterfieldmine", "Mergatroid",
+			"WheezySnoob", "MrSquids", "Snarky", "JazzHands",
+		},
+		Delimiters: []string{"=", " = ", "  =  "},
+		Separators: []string{";", " ; ", "  ;  "},
+	}
+	if err := c.Prepare(); err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+// countingWriter counts the calls to Write,
+// each of which is a write syscall when writing to an *os.File
+type countingWriter struct {
+	io.Writer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Writer.Write(p)
+}
+
+func BenchmarkGenerateSlabSize(b *testing.B) {
+	conf := benchConfig(b, 100000, 0, 1000)
+	for _, size := range []int{0, 4 << 10, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("slab=%d", size), func(b *testing.B) {
+			f, err := ioutil.TempFile("", "valistbench")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			out := &countingWriter{Writer: f}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := f.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				_, n, err := Generate(conf, out, Options{
+					SlabSize: size,
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(int64(n))
+			}
+			b.ReportMetric(float64(out.writes)/float64(b.N), "writes/op")
+		})
+	}
+}
+
+func BenchmarkGenerateValueCache(b *testing.B) {
+	for _, r := range []struct {
+		name           string
+		minVal, maxVal int32
+	}{
+		{"narrow", 0, 100},
+		{"wide", -1000000000, 1000000000},
+	} {
+		conf := benchConfig(b, 100000, r.minVal, r.maxVal)
+		for _, size := range []int{0, 128, 1024} {
+			b.Run(fmt.Sprintf("%s/cache=%d", r.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, n, err := Generate(conf, ioutil.Discard, Options{
+						SlabSize:       64 << 10,
+						ValueCacheSize: size,
+					})
+					if err != nil {
+						b.Fatal(err)
+					}
+					b.SetBytes(int64(n))
+				}
+			})
+		}
+	}
+}
+
+func TestWriteEntryAllocs(t *testing.T) {
+	c := &Config{
+		RandomSeed: 1,
+		MinValues:  math.MaxUint64,
+		MaxValues:  math.MaxUint64,
+		MinVal:     -1000,
+		MaxVal:     1000,
+		Labels:     []string{"A", "BB", "CCC"},
+		Delimiters: []string{"=", " = "},
+		Separators: []string{";", " ; "},
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []Options{
+		{SlabSize: 0},
+		{SlabSize: 4096},
+		{SlabSize: 4096, ValueCacheSize: 64},
+		{SlabSize: 4096, OnEntry: func(label []byte, value int64) {}},
+	} {
+		name := fmt.Sprintf(
+			"slab=%d/cache=%d/hook=%t",
+			opts.SlabSize, opts.ValueCacheSize, opts.OnEntry != nil,
+		)
+		t.Run(name, func(t *testing.T) {
+			g := newGenerator(c, ioutil.Discard, opts)
+
+			// Warm up
+			for i := 0; i < 10000; i++ {
+				if err := g.writeEntry(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			allocs := testing.AllocsPerRun(10000, func() {
+				if err := g.writeEntry(); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if allocs != 0 {
+				t.Errorf("expected 0 allocations per entry, got %f", allocs)
+			}
+		})
+	}
+}
+
+func manyLabels(n int) []string {
+	labels := make([]string, n)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("label%d", i)
+	}
+	return labels
+}
+
+func BenchmarkPrepareLabels1M(b *testing.B) {
+	labels := manyLabels(1000000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := &Config{
+			MinValues: 1,
+			MaxValues: 1,
+			Labels:    append([]string(nil), labels...),
+		}
+		if err := c.Prepare(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAggregateLabels1M(b *testing.B) {
+	c := &Config{
+		MinValues: 1,
+		MaxValues: 1,
+		Labels:    manyLabels(1000000),
+	}
+	if err := c.Prepare(); err != nil {
+		b.Fatal(err)
+	}
+	g := newGenerator(c, ioutil.Discard, Options{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if a := g.aggregate(); len(a) != len(c.Labels) {
+			b.Fatalf("unexpected aggregate length: %d", len(a))
+		}
+	}
+}
+
+func TestOnEntry(t *testing.T) {
+	c := &Config{
+		RandomSeed: 1,
+		MinValues:  1000,
+		MaxValues:  1000,
+		MinVal:     -1000,
+		MaxVal:     1000,
+		Labels:     []string{"A", "BB", "CCC"},
+		Separators: []string{";", " ; "},
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	aggregate := make(map[string]Aggregate)
+	aggr, _, err := Generate(c, ioutil.Discard, Options{
+		OnEntry: func(label []byte, value int64) {
+			a := aggregate[string(label)]
+			a.Values++
+			a.Value += int32(value)
+			a.Sum += value
+			aggregate[string(label)] = a
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aggregate) != len(aggr) {
+		t.Fatalf("expected %d labels, got %d", len(aggr), len(aggregate))
+	}
+	for l, expected := range aggr {
+		if actual := aggregate[l]; actual != expected {
+			t.Errorf("label %q: expected %+v, got %+v", l, expected, actual)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	c := &Config{
+		RandomSeed: 1,
+		MinValues:  1000,
+		MaxValues:  1000,
+		MinVal:     -1000,
+		MaxVal:     1000,
+		Labels:     []string{"A", "BB", "CCC"},
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	var windows []Window
+	aggr, _, err := Generate(c, ioutil.Discard, Options{
+		WindowSize: 300,
+		OnWindow: func(w Window) error {
+			windows = append(windows, w)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(windows) != 4 {
+		t.Fatalf("expected 4 windows, got %d", len(windows))
+	}
+	total := make(map[string]Aggregate)
+	for i, w := range windows {
+		if w.Index != uint64(i) || w.First != uint64(i*300) {
+			t.Errorf("unexpected window %d: %d (first: %d)", i, w.Index, w.First)
+		}
+		for l, a := range w.Aggregate {
+			x := total[l]
+			x.Values += a.Values
+			x.Value += a.Value
+			x.Sum += a.Sum
+			total[l] = x
+		}
+	}
+	if w := windows[3]; w.Last != 999 {
+		t.Errorf("expected last window to end at 999, got %d", w.Last)
+	}
+	if !reflect.DeepEqual(aggr, total) {
+		t.Errorf("windows don't add up to the aggregate: %+v, %+v", aggr, total)
+	}
+}
+
+func TestWindowsWithoutOnWindow(t *testing.T) {
+	c := &Config{
+		MinValues: 1,
+		MaxValues: 1,
+		Labels:    []string{"A"},
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	_, _, err := Generate(c, &out, Options{WindowSize: 1})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if out.Len() > 0 {
+		t.Errorf("expected no output, got %q", out.String())
+	}
+}
+
+// TestGenerateOutputIdentical verifies that options which don't affect
+// the generated list produce the same bytes as writing every entry
+// individually without caching
+func TestGenerateOutputIdentical(t *testing.T) {
+	c := &Config{
+		RandomSeed: 1,
+		MinValues:  1000,
+		MaxValues:  1000,
+		MinVal:     -1000,
+		MaxVal:     1000,
+		Labels:     []string{"A", "BB", "CCC"},
+		Delimiters: []string{"=", " = "},
+		Separators: []string{";", " ; "},
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	var expected bytes.Buffer
+	expectedAggr, expectedWritten, err := Generate(c, &expected, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []Options{
+		{SlabSize: 0},
+		{SlabSize: 1},
+		{SlabSize: 7},
+		{SlabSize: 4096},
+		{SlabSize: -1},
+		{SlabSize: 1 << 20},
+
+		// Capacities below the 2001 distinct values evict
+		{ValueCacheSize: 1},
+		{ValueCacheSize: 2},
+		{ValueCacheSize: 64},
+		{SlabSize: 7, ValueCacheSize: 1024},
+		{ValueCacheSize: 4096},
+	} {
+		name := fmt.Sprintf(
+			"slab=%d/cache=%d",
+			opts.SlabSize, opts.ValueCacheSize,
+		)
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			aggr, written, err := Generate(c, &out, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected.Bytes(), out.Bytes()) {
+				t.Errorf("output differs")
+			}
+			if written != expectedWritten || written != out.Len() {
+				t.Errorf(
+					"expected %d bytes written, got %d (output: %d)",
+					expectedWritten, written, out.Len(),
+				)
+			}
+			if !reflect.DeepEqual(expectedAggr, aggr) {
+				t.Errorf("expected aggregate %+v, got %+v", expectedAggr, aggr)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package valist
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// LevelAggregate represents the aggregate of all labels
+// sharing a particular hierarchy prefix.
+// Unlike Aggregate its value is 64-bit since the sum
+// of many labels may exceed the 32-bit range
+type LevelAggregate struct {
+	Values uint64 `json:"values"`
+	Value  int64  `json:"value"`
+}
+
+// generateLabels generates the hierarchical labels as the cartesian product
+// of the label components joined by the label component separator
+func (c *Config) generateLabels() error {
+	if len(c.Labels) > 0 {
+		return errors.New(
+			"labels and label-components are mutually exclusive",
+		)
+	}
+	if c.LabelComponentSeparator == "" {
+		c.LabelComponentSeparator = "."
+	}
+	sep := c.LabelComponentSeparator
+
+	count := 1
+	for level, components := range c.LabelComponents {
+		if len(components) < 1 {
+			return fmt.Errorf("missing label components at level %d", level)
+		}
+		if count > math.MaxInt32/len(components) {
+			return errors.New("too many label component combinations")
+		}
+		count *= len(components)
+
+		unique := make(map[string]struct{}, len(components))
+		for i, comp := range components {
+			if comp == "" {
+				return fmt.Errorf(
+					"invalid label component (empty) at level %d index %d",
+					level, i,
+				)
+			}
+			if _, ok := unique[comp]; ok {
+				return fmt.Errorf(
+					"duplicate label component (%q) at level %d index %d",
+					comp, level, i,
+				)
+			}
+			if strings.Contains(comp, sep) {
+				return fmt.Errorf(
+					"label component at level %d index %d "+
+						"contains the label component separator",
+					level, i,
+				)
+			}
+			for _, r := range comp {
+				if unicode.IsSpace(r) {
+					return fmt.Errorf(
+						"label component at level %d index %d contains spaces",
+						level, i,
+					)
+				}
+			}
+			unique[comp] = struct{}{}
+		}
+	}
+
+	c.Labels = make([]string, 0, count)
+	var b strings.Builder
+	indexes := make([]int, len(c.LabelComponents))
+	for {
+		b.Reset()
+		for level, i := range indexes {
+			if level > 0 {
+				b.WriteString(sep)
+			}
+			b.WriteString(c.LabelComponents[level][i])
+		}
+		c.Labels = append(c.Labels, b.String())
+
+		// Advance to the next combination
+		level := len(indexes) - 1
+		for ; level >= 0; level-- {
+			if indexes[level]++; indexes[level] < len(c.LabelComponents[level]) {
+				break
+			}
+			indexes[level] = 0
+		}
+		if level < 0 {
+			return nil
+		}
+	}
+}
+
+// LevelAggregates returns the aggregates of all hierarchy levels
+// where the element at index i aggregates by the first i+1 label components.
+// The levels are summed from Aggregate.Sum since Aggregate.Value
+// may have wrapped around.
+// Labels not generated from the label components are ignored.
+// Returns nil if the labels aren't hierarchical
+func (c *Config) LevelAggregates(
+	aggregate map[string]Aggregate,
+) []map[string]LevelAggregate {
+	if len(c.LabelComponents) < 1 {
+		return nil
+	}
+	levels := make([]map[string]LevelAggregate, len(c.LabelComponents))
+	for i := range levels {
+		levels[i] = make(map[string]LevelAggregate)
+	}
+
+	// The labels are generated in the order of the cartesian product,
+	// so the component indexes of a label follow from its index
+	// and its prefixes are found without searching for the separator,
+	// which may occur inside of components
+	indexes := make(map[string]int, len(c.Labels))
+	for i, l := range c.Labels {
+		indexes[l] = i
+	}
+	strides := make([]int, len(c.LabelComponents))
+	stride := 1
+	for level := len(strides) - 1; level >= 0; level-- {
+		strides[level] = stride
+		stride *= len(c.LabelComponents[level])
+	}
+
+	sep := c.LabelComponentSeparator
+	for label, a := range aggregate {
+		index, ok := indexes[label]
+		if !ok {
+			continue
+		}
+		prefixLen := 0
+		for level, components := range c.LabelComponents {
+			if level > 0 {
+				prefixLen += len(sep)
+			}
+			prefixLen += len(components[index/strides[level]%len(components)])
+			prefix := label[:prefixLen]
+			l := levels[level][prefix]
+			l.Values += a.Values
+			l.Value += a.Sum
+			levels[level][prefix] = l
+		}
+	}
+	return levels
+}
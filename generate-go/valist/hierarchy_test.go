@@ -0,0 +1,121 @@
+package valist
+
+import (
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestLevelAggregates(t *testing.T) {
+	c := &Config{
+		MinValues: 1,
+		MaxValues: 1,
+		LabelComponents: [][]string{
+			{"api", "db"},
+			{"eu", "us"},
+		},
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLabels := []string{"api.eu", "api.us", "db.eu", "db.us"}
+	if !reflect.DeepEqual(expectedLabels, c.Labels) {
+		t.Fatalf("expected labels %v, got %v", expectedLabels, c.Labels)
+	}
+
+	// Preparing again must keep the generated labels
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expectedLabels, c.Labels) {
+		t.Fatalf("expected labels %v, got %v", expectedLabels, c.Labels)
+	}
+
+	levels := c.LevelAggregates(map[string]Aggregate{
+		"api.eu": {Values: 1, Value: 1, Sum: 1},
+		"api.us": {Values: 2, Value: 2, Sum: 2},
+		"db.eu":  {Values: 3, Value: 3, Sum: 3},
+		// Value wrapped around int32
+		"db.us": {Values: 4, Value: math.MinInt32, Sum: math.MaxInt32 + 1},
+	})
+	expected := []map[string]LevelAggregate{
+		{
+			"api": {Values: 3, Value: 3},
+			"db":  {Values: 7, Value: math.MaxInt32 + 4},
+		},
+		{
+			"api.eu": {Values: 1, Value: 1},
+			"api.us": {Values: 2, Value: 2},
+			"db.eu":  {Values: 3, Value: 3},
+			"db.us":  {Values: 4, Value: math.MaxInt32 + 1},
+		},
+	}
+	if !reflect.DeepEqual(expected, levels) {
+		t.Errorf("expected %+v, got %+v", expected, levels)
+	}
+}
+
+func TestLevelAggregatesOverflow(t *testing.T) {
+	c := &Config{
+		MinValues:       2,
+		MaxValues:       2,
+		MinVal:          math.MaxInt32,
+		MaxVal:          math.MaxInt32,
+		LabelComponents: [][]string{{"api"}, {"eu"}},
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	aggregate, _, err := Generate(c, ioutil.Discard, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := c.LevelAggregates(aggregate)
+	if l := levels[0]["api"]; l.Value != 2*math.MaxInt32 {
+		t.Errorf("expected %d, got %d", int64(2*math.MaxInt32), l.Value)
+	}
+}
+
+func TestLevelAggregatesMultiCharSeparator(t *testing.T) {
+	c := &Config{
+		MinValues: 1,
+		MaxValues: 1,
+		LabelComponents: [][]string{
+			{"a.", "c"},
+			{"b", ".d"},
+		},
+		LabelComponentSeparator: "..",
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLabels := []string{"a...b", "a....d", "c..b", "c...d"}
+	if !reflect.DeepEqual(expectedLabels, c.Labels) {
+		t.Fatalf("expected labels %v, got %v", expectedLabels, c.Labels)
+	}
+
+	levels := c.LevelAggregates(map[string]Aggregate{
+		"a...b":  {Values: 1, Value: 1, Sum: 1},
+		"a....d": {Values: 2, Value: 2, Sum: 2},
+		"c..b":   {Values: 3, Value: 3, Sum: 3},
+		"c...d":  {Values: 4, Value: 4, Sum: 4},
+	})
+	expected := []map[string]LevelAggregate{
+		{
+			"a.": {Values: 3, Value: 3},
+			"c":  {Values: 7, Value: 7},
+		},
+		{
+			"a...b":  {Values: 1, Value: 1},
+			"a....d": {Values: 2, Value: 2},
+			"c..b":   {Values: 3, Value: 3},
+			"c...d":  {Values: 4, Value: 4},
+		},
+	}
+	if !reflect.DeepEqual(expected, levels) {
+		t.Errorf("expected %+v, got %+v", expected, levels)
+	}
+}
@@ -0,0 +1,103 @@
+package valist
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ConfigVersion is the current configuration schema version
+// and must equal len(migrations)+1
+const ConfigVersion = 1
+
+// migration upgrades a raw configuration by a single version
+type migration func(raw map[string]interface{}) (warnings []string, err error)
+
+// migrations upgrade a raw configuration where migrations[i]
+// upgrades version i+1 to version i+2.
+// Migrations must preserve the generated output of the older version.
+// Older configurations are decoded into Config before they're migrated
+// to determine their version, so keys must not change their type
+var migrations = []migration{}
+
+// migrateTOML decodes an older TOML config into a raw configuration,
+// migrates it to ConfigVersion and decodes the result
+func migrateTOML(data string) (*Config, []string, error) {
+	raw := make(map[string]interface{})
+	if _, err := toml.Decode(data, &raw); err != nil {
+		return nil, nil, err
+	}
+	warnings, err := migrate(raw, migrations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var b bytes.Buffer
+	if err := toml.NewEncoder(&b).Encode(raw); err != nil {
+		return nil, nil, fmt.Errorf("encoding migrated config: %w", err)
+	}
+	c := &Config{}
+	if _, err := toml.Decode(b.String(), c); err != nil {
+		return nil, nil, err
+	}
+	return c, warnings, nil
+}
+
+// migrate upgrades a raw configuration to version len(steps)+1
+func migrate(
+	raw map[string]interface{},
+	steps []migration,
+) (warnings []string, err error) {
+	current := int64(len(steps) + 1)
+	version, err := rawConfigVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConfigVersion(version, current); err != nil {
+		return nil, err
+	}
+
+	for ; version < current; version++ {
+		w, err := steps[version-1](raw)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"migrating from config-version %d: %w",
+				version, err,
+			)
+		}
+		warnings = append(warnings, w...)
+	}
+	raw["config-version"] = current
+	return warnings, nil
+}
+
+// rawConfigVersion returns the version of a raw configuration
+func rawConfigVersion(raw map[string]interface{}) (int64, error) {
+	switch v := raw["config-version"].(type) {
+	case nil:
+		// Version 1 predates the config-version key
+		return 1, nil
+	case int64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf(
+			"invalid config-version of type %T, expected an integer", v,
+		)
+	}
+}
+
+// checkConfigVersion returns an error if version isn't
+// within [1, current]
+func checkConfigVersion(version, current int64) error {
+	switch {
+	case version < 1:
+		return fmt.Errorf("invalid config-version (%d)", version)
+	case version > current:
+		return fmt.Errorf(
+			"config-version %d is newer than the supported version %d",
+			version, current,
+		)
+	}
+	return nil
+}
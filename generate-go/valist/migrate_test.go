@@ -0,0 +1,158 @@
+package valist
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func configFile(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "valistbench-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestConfigVersion(t *testing.T) {
+	if ConfigVersion != len(migrations)+1 {
+		t.Fatalf(
+			"ConfigVersion (%d) doesn't match %d migrations",
+			ConfigVersion, len(migrations),
+		)
+	}
+
+	for _, contents := range []string{
+		"min-values = 1\nmax-values = 1\nlabels = [\"A\"]",
+		"config-version = 1\nmin-values = 1\nmax-values = 1\nlabels = [\"A\"]",
+	} {
+		path := configFile(t, contents)
+		defer os.Remove(path)
+
+		c, warnings, err := ConfigFromFileTOML(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Version != ConfigVersion {
+			t.Errorf("expected version %d, got %d", ConfigVersion, c.Version)
+		}
+		if len(warnings) != 0 {
+			t.Errorf("expected no warnings, got %v", warnings)
+		}
+	}
+
+	for _, tt := range []struct {
+		contents string
+		err      string
+	}{
+		{"config-version = 99", "config-version 99 is newer"},
+		{"config-version = 0", "invalid config-version (0)"},
+		{
+			"config-version = 1.0",
+			"invalid config-version of type float64, expected an integer",
+		},
+	} {
+		path := configFile(t, tt.contents+"\nlabels = [\"A\"]")
+		defer os.Remove(path)
+		_, _, err := ConfigFromFileTOML(path)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf(
+				"%s: expected error containing %q, got %v",
+				tt.contents, tt.err, err,
+			)
+		}
+	}
+}
+
+// renameV1 is a test migration from version 1 to 2
+// renaming min-val to min-value
+func renameV1(raw map[string]interface{}) ([]string, error) {
+	v, ok := raw["min-val"]
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := raw["min-value"]; ok {
+		return nil, errors.New("both min-val and min-value are set")
+	}
+	delete(raw, "min-val")
+	raw["min-value"] = v
+	return []string{"min-val was renamed to min-value"}, nil
+}
+
+func TestMigrate(t *testing.T) {
+	raw := map[string]interface{}{
+		"min-val": int64(-5),
+		"labels":  []interface{}{"A"},
+	}
+	warnings, err := migrate(raw, []migration{renameV1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"config-version": int64(2),
+		"min-value":      int64(-5),
+		"labels":         []interface{}{"A"},
+	}
+	if !reflect.DeepEqual(raw, expected) {
+		t.Errorf("expected %v, got %v", expected, raw)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected 1 warning, got %d: %v", len(warnings), warnings)
+	}
+
+	// Current configurations are left untouched
+	raw = map[string]interface{}{
+		"config-version": int64(2),
+		"min-val":        int64(-5),
+	}
+	warnings, err = migrate(raw, []migration{renameV1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["min-val"]; !ok || len(warnings) != 0 {
+		t.Errorf("expected no migration, got %v (warnings: %v)", raw, warnings)
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		raw  map[string]interface{}
+		err  string
+	}{
+		{
+			"conflict",
+			map[string]interface{}{"min-val": int64(1), "min-value": int64(1)},
+			"migrating from config-version 1: both min-val and min-value",
+		},
+		{
+			"newer",
+			map[string]interface{}{"config-version": int64(99)},
+			"config-version 99 is newer",
+		},
+		{
+			"invalid",
+			map[string]interface{}{"config-version": 1.0},
+			"invalid config-version of type float64, expected an integer",
+		},
+		{
+			"zero",
+			map[string]interface{}{"config-version": int64(0)},
+			"invalid config-version",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrate(tt.raw, []migration{renameV1})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package valist
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+)
+
+const (
+	// hllPrecision is the number of HyperLogLog register index bits.
+	// Each label's sketch takes 2^hllPrecision bytes
+	hllPrecision = 12
+
+	// tDigestCompression bounds the number of t-digest centroids
+	tDigestCompression = 100
+)
+
+// SketchQuantiles are the quantiles estimated for every sketched label
+var SketchQuantiles = []float64{0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99}
+
+// Sketch holds approximate aggregates of a label's values
+// computed by probabilistic sketches.
+// Parsers computing sketches of their own are expected to match them
+// within tolerance, not exactly
+type Sketch struct {
+	// Distinct is the HyperLogLog estimate of the number of distinct values
+	Distinct uint64 `json:"distinct"`
+
+	// DistinctError is the relative standard error of Distinct
+	DistinctError float64 `json:"distinct-error"`
+
+	// Quantiles maps each of SketchQuantiles to its t-digest estimate
+	Quantiles map[string]float64 `json:"quantiles"`
+}
+
+// labelSketch sketches the values of a single label
+type labelSketch struct {
+	hll    hyperLogLog
+	digest tDigest
+}
+
+func (s *labelSketch) add(v int32) {
+	if s.hll.registers == nil {
+		// Allocate lazily to not waste memory on labels without values
+		s.hll = newHyperLogLog(hllPrecision)
+		s.digest = newTDigest(tDigestCompression)
+	}
+	s.hll.add(uint64(uint32(v)))
+	s.digest.add(float64(v))
+}
+
+func (s *labelSketch) sketch() *Sketch {
+	r := &Sketch{
+		DistinctError: 1.04 / math.Sqrt(float64(uint64(1)<<hllPrecision)),
+		Quantiles:     make(map[string]float64, len(SketchQuantiles)),
+	}
+	if s.hll.registers == nil {
+		return r
+	}
+	r.Distinct = s.hll.estimate()
+	for _, q := range SketchQuantiles {
+		r.Quantiles[strconv.FormatFloat(q, 'f', -1, 64)] = s.digest.quantile(q)
+	}
+	return r
+}
+
+// hyperLogLog estimates the number of distinct 64-bit keys
+type hyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func newHyperLogLog(precision uint8) hyperLogLog {
+	return hyperLogLog{
+		precision: precision,
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+func (h *hyperLogLog) add(key uint64) {
+	x := mix64(key)
+	i := x >> (64 - h.precision)
+	// The sentinel bit limits the rank to 64-precision+1
+	w := x<<h.precision | 1<<(h.precision-1)
+	if rank := uint8(bits.LeadingZeros64(w) + 1); rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Small range correction (linear counting)
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + 0.5)
+}
+
+// mix64 is the SplitMix64 finalizer
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// tDigest is a merging t-digest using the k1 (arcsine) scale function
+type tDigest struct {
+	compression float64
+	total       float64
+	min, max    float64
+
+	// Centroids sorted by mean
+	means, weights []float64
+
+	// unmerged holds values not yet merged into the centroids
+	unmerged []float64
+
+	// Merge buffers swapped with the centroids
+	tmpMeans, tmpWeights []float64
+}
+
+func newTDigest(compression float64) tDigest {
+	n := int(compression) + 1
+	return tDigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+		means:       make([]float64, 0, n),
+		weights:     make([]float64, 0, n),
+		unmerged:    make([]float64, 0, 5*n),
+		tmpMeans:    make([]float64, 0, n),
+		tmpWeights:  make([]float64, 0, n),
+	}
+}
+
+func (d *tDigest) add(x float64) {
+	if x < d.min {
+		d.min = x
+	}
+	if x > d.max {
+		d.max = x
+	}
+	d.unmerged = append(d.unmerged, x)
+	if len(d.unmerged) == cap(d.unmerged) {
+		d.merge()
+	}
+}
+
+func (d *tDigest) scale(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (d *tDigest) scaleInverse(k float64) float64 {
+	return (math.Sin(k*2*math.Pi/d.compression) + 1) / 2
+}
+
+// merge merges the unmerged values into the centroids
+func (d *tDigest) merge() {
+	if len(d.unmerged) < 1 {
+		return
+	}
+	sort.Float64s(d.unmerged)
+	d.total += float64(len(d.unmerged))
+
+	means, weights := d.tmpMeans[:0], d.tmpWeights[:0]
+	var q0 float64
+	qLimit := d.scaleInverse(d.scale(q0) + 1)
+	var mean, weight float64
+
+	// Merge the sorted centroids and unmerged values
+	for ci, ui := 0, 0; ci < len(d.means) || ui < len(d.unmerged); {
+		var m, w float64
+		if ui >= len(d.unmerged) ||
+			(ci < len(d.means) && d.means[ci] < d.unmerged[ui]) {
+			m, w = d.means[ci], d.weights[ci]
+			ci++
+		} else {
+			m, w = d.unmerged[ui], 1
+			ui++
+		}
+
+		if weight > 0 && q0+(weight+w)/d.total > qLimit {
+			means, weights = append(means, mean), append(weights, weight)
+			q0 += weight / d.total
+			qLimit = d.scaleInverse(d.scale(q0) + 1)
+			weight = 0
+		}
+		weight += w
+		mean += (m - mean) * w / weight
+	}
+	means, weights = append(means, mean), append(weights, weight)
+
+	d.tmpMeans, d.tmpWeights = d.means, d.weights
+	d.means, d.weights = means, weights
+	d.unmerged = d.unmerged[:0]
+}
+
+// quantile estimates the value at quantile q by interpolating
+// between the centroid means
+func (d *tDigest) quantile(q float64) float64 {
+	d.merge()
+	if len(d.means) < 1 {
+		return math.NaN()
+	}
+	if len(d.means) == 1 {
+		return d.means[0]
+	}
+	target := q * d.total
+
+	// Left of the first centroid's center
+	if c := d.weights[0] / 2; target < c {
+		return d.min + (d.means[0]-d.min)*target/c
+	}
+
+	var cumulative float64
+	for i := 0; i < len(d.means)-1; i++ {
+		left := cumulative + d.weights[i]/2
+		right := cumulative + d.weights[i] + d.weights[i+1]/2
+		if target < right {
+			return d.means[i] +
+				(d.means[i+1]-d.means[i])*(target-left)/(right-left)
+		}
+		cumulative += d.weights[i]
+	}
+
+	// Right of the last centroid's center
+	last := len(d.means) - 1
+	c := d.weights[last] / 2
+	lastCenter := d.total - c
+	return d.means[last] + (d.max-d.means[last])*(target-lastCenter)/c
+}
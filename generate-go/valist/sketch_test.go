@@ -0,0 +1,43 @@
+package valist
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, distinct := range []int{10, 1000, 100000} {
+		h := newHyperLogLog(hllPrecision)
+		for i := 0; i < 3; i++ {
+			// Repetitions must not affect the estimate
+			for v := 0; v < distinct; v++ {
+				h.add(uint64(v))
+			}
+		}
+		e := float64(h.estimate())
+		tolerance := 4 * 1.04 / math.Sqrt(float64(uint64(1)<<hllPrecision))
+		if relErr := math.Abs(e-float64(distinct)) / float64(distinct); relErr > tolerance {
+			t.Errorf(
+				"%d distinct: estimate %.0f exceeds tolerance (%.4f > %.4f)",
+				distinct, e, relErr, tolerance,
+			)
+		}
+	}
+}
+
+func TestTDigest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	d := newTDigest(tDigestCompression)
+	const max = 10000
+	for i := 0; i < 100000; i++ {
+		d.add(float64(r.Intn(max + 1)))
+	}
+	for _, q := range SketchQuantiles {
+		// Uniform distribution over [0, max]
+		expected := q * max
+		if e := d.quantile(q); math.Abs(e-expected) > 0.01*max {
+			t.Errorf("quantile %f: expected ~%f, got %f", q, expected, e)
+		}
+	}
+}
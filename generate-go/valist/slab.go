@@ -0,0 +1,48 @@
+package valist
+
+import "io"
+
+// slabWriter batches whole entries into a contiguous slab
+// which is written to the underlying writer in a single call
+// once it reaches the configured size.
+// A slab size of 0 writes every entry individually
+type slabWriter struct {
+	out     io.Writer
+	size    int
+	buf     []byte
+	written int
+}
+
+// newSlabWriter creates a new slab writer.
+// maxEntry is the maximum length of a single entry and is reserved
+// in addition to size to avoid growing the slab
+func newSlabWriter(out io.Writer, size, maxEntry int) *slabWriter {
+	if size < 0 {
+		size = 0
+	}
+	return &slabWriter{
+		out:  out,
+		size: size,
+		buf:  make([]byte, 0, size+maxEntry),
+	}
+}
+
+// commit must be called after every appended entry,
+// it writes the slab once it's full
+func (w *slabWriter) commit() error {
+	if len(w.buf) < w.size {
+		return nil
+	}
+	return w.flush()
+}
+
+// flush writes the slab to the underlying writer and resets it
+func (w *slabWriter) flush() error {
+	if len(w.buf) < 1 {
+		return nil
+	}
+	n, err := w.out.Write(w.buf)
+	w.written += n
+	w.buf = w.buf[:0]
+	return err
+}
@@ -0,0 +1,69 @@
+package valist
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AnswerKey is the ground truth of top-K queries over an aggregate
+type AnswerKey struct {
+	K int `json:"k"`
+
+	// ByCount holds the K labels with the most values
+	ByCount []RankedLabel `json:"by-count"`
+
+	// BySum holds the K labels with the greatest aggregate value
+	BySum []RankedLabel `json:"by-sum"`
+}
+
+// RankedLabel is a single label of a top-K ranking.
+// Like LevelAggregate its value is 64-bit since the sum
+// of a label may exceed the 32-bit range
+type RankedLabel struct {
+	Label  string `json:"label"`
+	Values uint64 `json:"values"`
+	Value  int64  `json:"value"`
+}
+
+// TopK computes the top-K answer key of the given aggregate.
+// Labels ranking equally are ordered lexicographically
+// to keep the answer key deterministic.
+// Labels are ranked by Aggregate.Sum since Aggregate.Value
+// may have wrapped around.
+// Returns an error if k is negative
+func TopK(aggregate map[string]Aggregate, k int) (AnswerKey, error) {
+	if k < 0 {
+		return AnswerKey{}, fmt.Errorf("invalid k (%d)", k)
+	}
+	ranked := make([]RankedLabel, 0, len(aggregate))
+	for l, a := range aggregate {
+		ranked = append(ranked, RankedLabel{
+			Label:  l,
+			Values: a.Values,
+			Value:  a.Sum,
+		})
+	}
+	if k > len(ranked) {
+		k = len(ranked)
+	}
+
+	key := AnswerKey{K: k}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Values != ranked[j].Values {
+			return ranked[i].Values > ranked[j].Values
+		}
+		return ranked[i].Label < ranked[j].Label
+	})
+	key.ByCount = append([]RankedLabel(nil), ranked[:k]...)
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Value != ranked[j].Value {
+			return ranked[i].Value > ranked[j].Value
+		}
+		return ranked[i].Label < ranked[j].Label
+	})
+	key.BySum = append([]RankedLabel(nil), ranked[:k]...)
+
+	return key, nil
+}
@@ -0,0 +1,85 @@
+package valist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopK(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		aggregate map[string]Aggregate
+		k         int
+		expected  AnswerKey
+	}{
+		{
+			name: "ties",
+			aggregate: map[string]Aggregate{
+				"A": {Values: 3, Value: 64, Sum: 64},
+				"B": {Values: 1, Value: -700, Sum: -700},
+				"C": {Values: 2, Value: 0, Sum: 0},
+				"D": {Values: 2, Value: 64, Sum: 64},
+			},
+			k: 2,
+			expected: AnswerKey{
+				K: 2,
+				ByCount: []RankedLabel{
+					{Label: "A", Values: 3, Value: 64},
+					{Label: "C", Values: 2, Value: 0},
+				},
+				BySum: []RankedLabel{
+					{Label: "A", Values: 3, Value: 64},
+					{Label: "D", Values: 2, Value: 64},
+				},
+			},
+		},
+		{
+			// The values wrapped around int32 and rank C first
+			name: "wrapped sums",
+			aggregate: map[string]Aggregate{
+				"A": {Values: 20, Value: 1860877435, Sum: 19040746619},
+				"B": {Values: 9, Value: 75722479, Sum: 8665657071},
+				"C": {Values: 11, Value: 1940507825, Sum: 10530442417},
+			},
+			k: 1,
+			expected: AnswerKey{
+				K: 1,
+				ByCount: []RankedLabel{
+					{Label: "A", Values: 20, Value: 19040746619},
+				},
+				BySum: []RankedLabel{
+					{Label: "A", Values: 20, Value: 19040746619},
+				},
+			},
+		},
+		{
+			name: "k exceeds labels",
+			aggregate: map[string]Aggregate{
+				"A": {Values: 1, Value: 5, Sum: 5},
+			},
+			k: 3,
+			expected: AnswerKey{
+				K:       1,
+				ByCount: []RankedLabel{{Label: "A", Values: 1, Value: 5}},
+				BySum:   []RankedLabel{{Label: "A", Values: 1, Value: 5}},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := TopK(tt.aggregate, tt.k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.expected, key) {
+				t.Errorf("expected %+v, got %+v", tt.expected, key)
+			}
+		})
+	}
+}
+
+func TestTopKInvalid(t *testing.T) {
+	_, err := TopK(map[string]Aggregate{"A": {Values: 1, Value: 1}}, -1)
+	if err == nil {
+		t.Fatal("expected error for negative k")
+	}
+}
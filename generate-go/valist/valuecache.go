@@ -0,0 +1,100 @@
+package valist
+
+import "strconv"
+
+// maxValueLen is the length of the longest formatted 32-bit integer
+const maxValueLen = len("-2147483648")
+
+// valueCache is a fixed-capacity LRU cache of formatted values
+// allowing repeated values to skip formatting entirely.
+// A cache lookup is not necessarily cheaper than strconv.AppendInt,
+// see BenchmarkGenerateValueCache before enabling it
+type valueCache struct {
+	index map[int32]int32
+	nodes []valueCacheNode
+	// slots holds the formatted values with maxValueLen bytes per node
+	slots []byte
+	// head and tail are the most and least recently used nodes
+	head, tail int32
+}
+
+type valueCacheNode struct {
+	value      int32
+	prev, next int32
+	len        uint8
+}
+
+// newValueCache creates a new value cache of the given capacity.
+// Returns nil if capacity is 0
+func newValueCache(capacity int) *valueCache {
+	if capacity < 1 {
+		return nil
+	}
+	return &valueCache{
+		index: make(map[int32]int32, capacity),
+		nodes: make([]valueCacheNode, 0, capacity),
+		slots: make([]byte, capacity*maxValueLen),
+		head:  -1,
+		tail:  -1,
+	}
+}
+
+// appendValue appends the formatted value to dst
+func (c *valueCache) appendValue(dst []byte, v int32) []byte {
+	if i, ok := c.index[v]; ok {
+		c.touch(i)
+		return append(dst, c.slot(i)...)
+	}
+
+	var i int32
+	if len(c.nodes) < cap(c.nodes) {
+		i = int32(len(c.nodes))
+		c.nodes = append(c.nodes, valueCacheNode{prev: -1, next: -1})
+	} else {
+		// Evict the least recently used value
+		i = c.tail
+		delete(c.index, c.nodes[i].value)
+	}
+
+	s := c.slots[int(i)*maxValueLen : int(i)*maxValueLen]
+	c.nodes[i].value = v
+	c.nodes[i].len = uint8(len(strconv.AppendInt(s, int64(v), 10)))
+	c.index[v] = i
+	c.touch(i)
+	return append(dst, c.slot(i)...)
+}
+
+func (c *valueCache) slot(i int32) []byte {
+	off := int(i) * maxValueLen
+	return c.slots[off : off+int(c.nodes[i].len)]
+}
+
+// touch moves node i to the head of the list
+func (c *valueCache) touch(i int32) {
+	if c.head == i {
+		return
+	}
+	n := &c.nodes[i]
+
+	// Unlink
+	if n.prev != -1 {
+		c.nodes[n.prev].next = n.next
+	}
+	if n.next != -1 {
+		c.nodes[n.next].prev = n.prev
+	}
+	if c.tail == i && n.prev != -1 {
+		c.tail = n.prev
+	}
+
+	// Link as head
+	n.prev = -1
+	n.next = c.head
+	if c.head != -1 {
+		c.nodes[c.head].prev = i
+	}
+	c.head = i
+	if c.tail == -1 {
+		c.tail = i
+	}
+}
@@ -0,0 +1,67 @@
+package valist
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// order returns the cached values from the most to the least recently used
+// verifying the links in both directions
+func (c *valueCache) order(t *testing.T) []int32 {
+	var values []int32
+	prev := int32(-1)
+	for i := c.head; i != -1; i = c.nodes[i].next {
+		if c.nodes[i].prev != prev {
+			t.Fatalf(
+				"node %d links to %d instead of %d",
+				i, c.nodes[i].prev, prev,
+			)
+		}
+		values = append(values, c.nodes[i].value)
+		prev = i
+	}
+	if c.tail != prev {
+		t.Fatalf("expected tail %d, got %d", prev, c.tail)
+	}
+	if len(values) != len(c.index) {
+		t.Fatalf("%d linked nodes but %d indexed", len(values), len(c.index))
+	}
+	return values
+}
+
+func TestValueCache(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		capacity int
+		values   []int32
+		expected []int32
+	}{
+		{"capacity 1", 1, []int32{1, 2, 2, 1}, []int32{1}},
+		{"hit", 2, []int32{1, 2, 1}, []int32{1, 2}},
+		{"evict", 2, []int32{1, 2, 1, 3}, []int32{3, 1}},
+		{"evict twice", 2, []int32{1, 2, 3, 4}, []int32{4, 3}},
+		{"touch tail", 3, []int32{1, 2, 3, 1, 4}, []int32{4, 1, 3}},
+		{"touch middle", 3, []int32{1, 2, 3, 2, 4}, []int32{4, 2, 3}},
+		{
+			"extremes", 2,
+			[]int32{math.MinInt32, math.MaxInt32},
+			[]int32{math.MaxInt32, math.MinInt32},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newValueCache(tt.capacity)
+			for _, v := range tt.values {
+				actual := string(c.appendValue([]byte("x"), v))
+				if expected := "x" + strconv.Itoa(int(v)); actual != expected {
+					t.Fatalf("expected %q, got %q", expected, actual)
+				}
+				c.order(t)
+			}
+			if order := c.order(t); !reflect.DeepEqual(tt.expected, order) {
+				t.Errorf("expected order %v, got %v", tt.expected, order)
+			}
+		})
+	}
+}
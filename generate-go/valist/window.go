@@ -0,0 +1,78 @@
+package valist
+
+// Window is the aggregate of a tumbling window of consecutive entries
+type Window struct {
+	Index uint64 `json:"index"`
+
+	// First and Last are the zero-based indexes
+	// of the first and last entry of the window
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+
+	// Aggregate contains only the labels occurring in the window
+	Aggregate map[string]Aggregate `json:"aggregate"`
+}
+
+// windowAggregator aggregates the entries of the current window
+type windowAggregator struct {
+	size    uint64
+	onEmit  func(Window) error
+	index   uint64
+	first   uint64
+	labels  []string
+	sums    []int64
+	counts  []uint64
+	touched []int // Indexes of the labels occurring in the window
+}
+
+func newWindowAggregator(
+	labels []string,
+	size uint64,
+	onEmit func(Window) error,
+) *windowAggregator {
+	return &windowAggregator{
+		size:   size,
+		onEmit: onEmit,
+		labels: labels,
+		sums:   make([]int64, len(labels)),
+		counts: make([]uint64, len(labels)),
+	}
+}
+
+// add adds the entry at the given index and emits the window
+// once it's complete or if it's the last entry
+func (w *windowAggregator) add(
+	entry uint64,
+	last bool,
+	labelIndex int,
+	value int32,
+) error {
+	if w.counts[labelIndex] == 0 {
+		w.touched = append(w.touched, labelIndex)
+	}
+	w.sums[labelIndex] += int64(value)
+	w.counts[labelIndex]++
+
+	if entry+1-w.first < w.size && !last {
+		return nil
+	}
+
+	win := Window{
+		Index:     w.index,
+		First:     w.first,
+		Last:      entry,
+		Aggregate: make(map[string]Aggregate, len(w.touched)),
+	}
+	for _, i := range w.touched {
+		win.Aggregate[w.labels[i]] = Aggregate{
+			Values: w.counts[i],
+			Value:  int32(w.sums[i]),
+			Sum:    w.sums[i],
+		}
+		w.sums[i], w.counts[i] = 0, 0
+	}
+	w.touched = w.touched[:0]
+	w.index++
+	w.first = entry + 1
+	return w.onEmit(win)
+}